@@ -14,6 +14,8 @@
 package main
 
 import (
+	"time"
+
 	"rcs-onboarding/internal/config"
 	"rcs-onboarding/internal/handlers"
 	"rcs-onboarding/internal/middleware"
@@ -43,56 +45,236 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.FormVersion{}, &models.Submission{}, &models.AuditLog{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.FormVersion{}, &models.Submission{}, &models.AuditLog{}, &models.Session{}, &models.OneTimeToken{}, &models.PasswordHistory{}, &models.LoginThrottle{}, &models.MFARecoveryCode{}, &models.APIKey{}, &models.SigningKey{}, &models.Organization{}, &models.RoleDefinition{}, &models.RolePermission{}, &models.KnownPermission{}, &models.Invitation{}, &models.FormTypeDefinition{}, &models.DraftMigration{}, &models.MigrationRun{}); err != nil {
 		log.Fatal().Err(err).Msg("Migration failed")
 	}
 
+	utils.SeedRoles(db)
 	utils.SeedTemplates(db)
+	utils.SeedFormRules(db)
+	utils.SeedFormLifecycle(db)
+	utils.SeedFormTypes(db)
 	utils.SeedUsers(db)
+	utils.SeedOrganizations(db)
 
 	userRepo := repositories.NewUserRepo(db)
 	formRepo := repositories.NewFormRepo(db)
 	submissionRepo := repositories.NewSubmissionRepo(db)
 	auditRepo := repositories.NewAuditRepo(db)
+	sessionRepo := repositories.NewSessionRepo(db)
+	tokenRepo := repositories.NewTokenRepo(db)
+	loginThrottleRepo := repositories.NewLoginThrottleRepo(db)
+	apiKeyRepo := repositories.NewAPIKeyRepo(db)
+	signingKeyRepo := repositories.NewSigningKeyRepo(db)
+	organizationRepo := repositories.NewOrganizationRepo(db)
+	roleRepo := repositories.NewRoleRepo(db)
+	invitationRepo := repositories.NewInvitationRepo(db)
+	formTypeRepo := repositories.NewFormTypeRepo(db)
+	draftMigrationRepo := repositories.NewDraftMigrationRepo(db)
+
+	policyService, err := services.NewPolicyService(roleRepo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load role permissions")
+	}
+
+	passwordPolicy, err := services.NewPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load password policy")
+	}
+	notifier, err := services.NewNotifier(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure notifier")
+	}
+	mailer, err := services.NewMailer(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure mailer")
+	}
+
+	keyRing, err := services.NewKeyRing(signingKeyRepo, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT signing keys")
+	}
+	go keyRing.Run(time.Hour, make(chan struct{}))
+	loginGuard := services.NewLoginGuard(loginThrottleRepo, auditRepo, cfg)
+	var oidcClient *services.OIDCClient
+	if cfg.OIDCIssuerURL != "" {
+		oidcClient = services.NewOIDCClient(cfg)
+	}
 
-	authService := services.NewAuthService(userRepo)
-	formService := services.NewFormService(formRepo)
-	submissionService := services.NewSubmissionService(submissionRepo, formRepo, auditRepo)
+	authService := services.NewAuthService(userRepo, sessionRepo, tokenRepo, passwordPolicy, notifier, loginGuard, apiKeyRepo, keyRing, oidcClient, policyService, cfg)
+	formTypeService := services.NewFormTypeService(formTypeRepo, policyService)
+	formService := services.NewFormService(formRepo, formTypeService)
+	submissionService := services.NewSubmissionService(submissionRepo, formRepo, userRepo, policyService, formTypeService)
+	draftMigrationService := services.NewDraftMigrationService(draftMigrationRepo, submissionRepo, formRepo, formService, submissionService)
 	auditService := services.NewAuditService(auditRepo)
+	organizationService := services.NewOrganizationService(organizationRepo, userRepo, policyService)
+	invitationService := services.NewInvitationService(invitationRepo, organizationRepo, userRepo, tokenRepo, authService, mailer, cfg)
 
 	authHandler := handlers.NewAuthHandler(authService)
-	formHandler := handlers.NewFormHandler(formService)
-	submissionHandler := handlers.NewSubmissionHandler(submissionService, auditService)
+	userHandler := handlers.NewUserHandler(authService, auditService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService)
+	organizationHandler := handlers.NewOrganizationHandler(organizationService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	roleHandler := handlers.NewRoleHandler(policyService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	formHandler := handlers.NewFormHandler(formService, policyService)
+	formTypeHandler := handlers.NewFormTypeHandler(formTypeService, policyService)
+	submissionHandler := handlers.NewSubmissionHandler(submissionService)
+	draftMigrationHandler := handlers.NewDraftMigrationHandler(draftMigrationService)
 
 	r := gin.Default()
+	authRequired := middleware.AuthMiddleware(authService)
+	selfOnly := middleware.DenyImpersonation()
+	can := func(perm models.Permission) gin.HandlerFunc {
+		return middleware.RequirePermission(policyService, perm)
+	}
 
 	api := r.Group("/api/v1")
+	api.Use(middleware.AuditImpersonation(auditService))
 	{
 		api.POST("/auth/login", authHandler.Login)
+		api.POST("/auth/refresh", authHandler.Refresh)
+		api.POST("/auth/logout", authRequired, authHandler.Logout)
+		api.POST("/auth/password", authRequired, selfOnly, authHandler.ChangePassword)
+		api.POST("/auth/password/reset", authHandler.ResetPassword)
+		api.GET("/auth/oidc/login", authHandler.OIDCLogin)
+		api.GET("/auth/oidc/callback", authHandler.OIDCCallback)
+		api.POST("/auth/mfa/verify", authHandler.VerifyMFA)
+		api.POST("/auth/mfa/enroll", authRequired, selfOnly, authHandler.EnrollMFA)
+		api.POST("/auth/mfa/confirm", authRequired, selfOnly, authHandler.ConfirmMFA)
+		api.POST("/auth/mfa/disable", authRequired, selfOnly, authHandler.DisableMFA)
+		api.GET("/auth/sessions", authRequired, selfOnly, authHandler.ListSessions)
+		api.DELETE("/auth/sessions", authRequired, selfOnly, authHandler.RevokeOtherSessions)
+		api.DELETE("/auth/sessions/:id", authRequired, selfOnly, authHandler.RevokeSession)
+		api.POST("/auth/register", invitationHandler.Register)
+		api.GET("/auth/verify-email", invitationHandler.VerifyEmail)
+		api.POST("/auth/verify-email", invitationHandler.VerifyEmail)
+		api.POST("/auth/verify-email/resend", authRequired, selfOnly, invitationHandler.ResendVerification)
+
+		users := api.Group("/users")
+		users.Use(authRequired, can(models.PermUserManage))
+		{
+			users.POST("", userHandler.Create)
+			users.GET("", userHandler.List)
+			users.PATCH("/:id/role", userHandler.UpdateRole)
+			users.POST("/:id/disable", userHandler.Disable)
+			users.POST("/:id/enable", userHandler.Enable)
+			users.DELETE("/:id", userHandler.Delete)
+			users.POST("/:id/password-reset", userHandler.ResetPassword)
+			users.POST("/:id/unlock", userHandler.Unlock)
+			users.GET("/:id/sessions", userHandler.ListSessions)
+			users.DELETE("/:id/sessions", userHandler.RevokeSessions)
+			users.POST("/:id/impersonate", can(models.PermUserImpersonate), userHandler.Impersonate)
+		}
+
+		organizations := api.Group("/organizations")
+		organizations.Use(authRequired, can(models.PermOrganizationManage))
+		{
+			organizations.POST("", organizationHandler.Create)
+			organizations.GET("", organizationHandler.List)
+			organizations.GET("/:id/members", organizationHandler.Members)
+			organizations.POST("/:id/members", organizationHandler.AddMember)
+			organizations.DELETE("/:id/members/:userId", organizationHandler.RemoveMember)
+		}
+
+		invitations := api.Group("/invitations")
+		invitations.Use(authRequired, can(models.PermInvitationCreate))
+		{
+			invitations.POST("", invitationHandler.Create)
+			invitations.GET("", invitationHandler.List)
+			invitations.DELETE("/:id", invitationHandler.Revoke)
+		}
+
+		roles := api.Group("/roles")
+		roles.Use(authRequired, can(models.PermRoleManage))
+		{
+			roles.GET("", roleHandler.List)
+			roles.POST("", roleHandler.Create)
+			roles.GET("/permissions", roleHandler.ListPermissions)
+			roles.PUT("/:role/permissions", roleHandler.SetPermissions)
+			roles.DELETE("/:role", roleHandler.Delete)
+		}
+
+		api.GET("/audit-logs", authRequired, can(models.PermAuditRead), auditHandler.List)
+
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(authRequired, can(models.PermAPIKeyManage))
+		{
+			apiKeys.POST("", apiKeyHandler.Create)
+			apiKeys.GET("", apiKeyHandler.List)
+			apiKeys.DELETE("/:id", apiKeyHandler.Revoke)
+		}
+
+		formTypes := api.Group("/form-types")
+		formTypes.Use(authRequired, can(models.PermFormRead))
+		{
+			formTypes.GET("", formTypeHandler.List)
+			formTypes.GET("/:key", formTypeHandler.Get)
+			formTypes.POST("", can(models.PermFormTypeManage), formTypeHandler.Create)
+			formTypes.PATCH("/:key", can(models.PermFormTypeManage), formTypeHandler.Update)
+		}
 
 		forms := api.Group("/forms")
-		forms.Use(middleware.AuthMiddleware())
+		forms.Use(authRequired, can(models.PermFormRead))
 		{
-			forms.POST("/:type", middleware.RoleMiddleware(models.Admin), formHandler.Create)
+			forms.GET("/formats", formHandler.ListFormats)
+			forms.POST("/:type", can(models.PermFormPublish), formHandler.Create)
+			forms.POST("/:type/validate", can(models.PermFormPublish), formHandler.Validate)
 			forms.GET("/:type/versions", formHandler.ListVersions)
 			forms.GET("/:type/versions/latest", formHandler.GetLatest)
+			forms.GET("/:type/versions/:version", formHandler.GetVersion)
+			forms.GET("/:type/versions/:version/diff/:other", formHandler.Diff)
+			forms.PUT("/:type/versions/:version", can(models.PermFormPublish), formHandler.UpdateDraft)
+			forms.POST("/:type/versions/:version/publish", can(models.PermFormPublish), formHandler.Publish)
+			forms.POST("/:type/versions/:version/retire", can(models.PermFormPublish), formHandler.Retire)
+			forms.POST("/:type/versions/:version/migrate-drafts", can(models.PermFormPublish), draftMigrationHandler.MigrateDrafts)
+			forms.GET("/:type/migrations/:run", can(models.PermFormPublish), draftMigrationHandler.GetRun)
+			forms.GET("/:type/migrations/:run/reports", can(models.PermFormPublish), draftMigrationHandler.ListReports)
 		}
 
 		submissions := api.Group("/submissions")
-		submissions.Use(middleware.AuthMiddleware())
+		submissions.Use(authRequired)
 		{
 			// Register specific route first (longer path)
-			submissions.POST("/:id/review", middleware.RoleMiddleware(models.TPM, models.Sales), submissionHandler.Review)
+			submissions.POST("/:id/review", can(models.PermSubmissionReview), submissionHandler.Review)
 
 			// Then the general wildcard route
-			submissions.POST("/:id", middleware.RoleMiddleware(models.Customer), submissionHandler.Submit)
+			submissions.POST("/:id", can(models.PermSubmissionCreate), submissionHandler.Submit)
 
 			submissions.GET("", submissionHandler.GetFiltered)
 			submissions.GET("/:id", submissionHandler.GetByID)
-			submissions.PUT("/:id", middleware.RoleMiddleware(models.Customer), submissionHandler.UpdateDraft)
+			submissions.PUT("/:id", can(models.PermSubmissionCreate), submissionHandler.UpdateDraft)
+			submissions.PUT("/:id/pin", can(models.PermSubmissionCreate), submissionHandler.SetPinned)
+			submissions.GET("/:id/migrations", draftMigrationHandler.ListForSubmission)
+		}
+	}
+
+	if cfg.SCIMToken != "" {
+		scimService, err := services.NewSCIMService(userRepo, authService, policyService, auditService, cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up SCIM")
+		}
+		scimHandler := handlers.NewSCIMHandler(scimService)
+		scim := r.Group("/scim/v2")
+		scim.Use(middleware.SCIMAuth(cfg.SCIMToken))
+		{
+			scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+			scim.GET("/Users", scimHandler.ListUsers)
+			scim.POST("/Users", scimHandler.CreateUser)
+			scim.GET("/Users/:id", scimHandler.GetUser)
+			scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+			scim.PATCH("/Users/:id", scimHandler.PatchUser)
+			scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+			scim.GET("/Groups", scimHandler.ListGroups)
+			scim.POST("/Groups", scimHandler.GroupsNotManaged)
+			scim.GET("/Groups/:id", scimHandler.GetGroup)
+			scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+			scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+			scim.DELETE("/Groups/:id", scimHandler.GroupsNotManaged)
 		}
 	}
 
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	log.Info().Msg("Server starting on :8083")
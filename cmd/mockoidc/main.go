@@ -0,0 +1,41 @@
+// Command mockoidc is a minimal OpenID Connect provider for exercising the
+// SSO login flow locally. It approves every authorization request without a
+// login screen: pass ?login_hint=<user> to pick one of the MOCK_OIDC_USERS.
+//
+//	MOCK_OIDC_ADDR=:9000
+//	MOCK_OIDC_USERS="tpm.jane=rcs-tpm,sales.joe=rcs-sales,ops.ann=rcs-admins|rcs-tpm"
+//
+// Point the API at it with OIDC_ISSUER_URL=http://localhost:9000,
+// OIDC_CLIENT_ID=rcs-onboarding and
+// OIDC_ROLE_MAPPING="rcs-admins=admin,rcs-tpm=tpm,rcs-sales=sales".
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"rcs-onboarding/internal/mockoidc"
+
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	addr := getEnv("MOCK_OIDC_ADDR", ":9000")
+	users := mockoidc.ParseUsers(getEnv("MOCK_OIDC_USERS", "tpm.jane=rcs-tpm,sales.joe=rcs-sales,ops.ann=rcs-admins"))
+	p, err := mockoidc.NewProvider(getEnv("MOCK_OIDC_ISSUER", "http://localhost"+addr), users)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate key")
+	}
+
+	log.Info().Str("issuer", p.Issuer()).Msg("Mock OIDC provider starting on " + addr)
+	if err := http.ListenAndServe(addr, p); err != nil {
+		log.Fatal().Err(err).Msg("Server failed")
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
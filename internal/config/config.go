@@ -2,17 +2,128 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DSN    string
-	JWTKey []byte
+	DSN             string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	JWTAlgorithm        string // RS256 or EdDSA
+	JWTIssuer           string
+	JWTRotationPeriod   time.Duration
+	JWTKeyEncryptionKey string // base64 AES-256 key that encrypts stored signing keys
+	ImpersonationTTL    time.Duration
+
+	PasswordMinLength      int
+	PasswordRequireUpper   bool
+	PasswordRequireLower   bool
+	PasswordRequireDigit   bool
+	PasswordRequireSymbol  bool
+	PasswordBreachListFile string
+	PasswordHistorySize    int
+	PasswordResetTTL       time.Duration
+
+	Notifier    string // log or file
+	NotifierDir string
+
+	Mailer       string // smtp or file
+	MailDir      string
+	MailFrom     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	AppBaseURL   string // used to build links in emails
+
+	InvitationTTL        time.Duration
+	EmailVerificationTTL time.Duration
+
+	LoginMaxFailures     int // per username, before lockout
+	LoginMaxIPFailures   int // per client IP, before lockout
+	LoginLockoutDuration time.Duration
+	LoginBackoffBase     time.Duration
+	LoginBackoffMax      time.Duration
+
+	MFAIssuer        string
+	MFARequiredRoles []string
+	MFAChallengeTTL  time.Duration
+
+	APIKeyDefaultTTL time.Duration
+	APIKeyMaxTTL     time.Duration
+
+	OIDCIssuerURL    string // empty disables SSO
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	OIDCRoleMapping  []string // "group=role" entries, first match wins
+
+	SCIMToken       string // empty disables the SCIM endpoints
+	SCIMDefaultRole string // role of provisioned users outside every group
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		DSN:    getEnv("DB_DSN", "new_user:password@tcp(localhost:3306)/rcs_onboarding?parseTime=true"),
-		JWTKey: []byte(getEnv("JWT_SECRET", "secret_key")),
+		DSN:             getEnv("DB_DSN", "new_user:password@tcp(localhost:3306)/rcs_onboarding?parseTime=true"),
+		AccessTokenTTL:  getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDurationEnv("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+
+		JWTAlgorithm:        getEnv("JWT_ALGORITHM", "RS256"),
+		JWTIssuer:           getEnv("JWT_ISSUER", "rcs-onboarding"),
+		JWTRotationPeriod:   getDurationEnv("JWT_ROTATION_PERIOD", 30*24*time.Hour),
+		JWTKeyEncryptionKey: getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
+		ImpersonationTTL:    getDurationEnv("IMPERSONATION_TTL", 30*time.Minute),
+
+		PasswordMinLength:      getIntEnv("PASSWORD_MIN_LENGTH", 10),
+		PasswordRequireUpper:   getBoolEnv("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:   getBoolEnv("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:   getBoolEnv("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol:  getBoolEnv("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordBreachListFile: getEnv("PASSWORD_BREACH_LIST_FILE", ""),
+		PasswordHistorySize:    getIntEnv("PASSWORD_HISTORY_SIZE", 5),
+		PasswordResetTTL:       getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+
+		Notifier:    getEnv("NOTIFIER", "log"),
+		NotifierDir: getEnv("NOTIFIER_DIR", "./notifications"),
+
+		Mailer:       getEnv("MAILER", "file"),
+		MailDir:      getEnv("MAIL_DIR", "./mail"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@rcs-onboarding.local"),
+		SMTPAddr:     getEnv("SMTP_ADDR", "localhost:587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		AppBaseURL:   getEnv("APP_BASE_URL", "http://localhost:8083"),
+
+		InvitationTTL:        getDurationEnv("INVITATION_TTL", 7*24*time.Hour),
+		EmailVerificationTTL: getDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+
+		LoginMaxFailures:     getIntEnv("LOGIN_MAX_FAILURES", 5),
+		LoginMaxIPFailures:   getIntEnv("LOGIN_MAX_IP_FAILURES", 20),
+		LoginLockoutDuration: getDurationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginBackoffBase:     getDurationEnv("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:      getDurationEnv("LOGIN_BACKOFF_MAX", time.Minute),
+
+		MFAIssuer:        getEnv("MFA_ISSUER", "RCS Onboarding"),
+		MFARequiredRoles: getListEnv("MFA_REQUIRED_ROLES", []string{"admin", "tpm", "sales"}),
+		MFAChallengeTTL:  getDurationEnv("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		APIKeyDefaultTTL: getDurationEnv("API_KEY_DEFAULT_TTL", 90*24*time.Hour),
+		APIKeyMaxTTL:     getDurationEnv("API_KEY_MAX_TTL", 365*24*time.Hour),
+
+		OIDCIssuerURL:    getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8083/api/v1/auth/oidc/callback"),
+		OIDCScopes:       getListEnv("OIDC_SCOPES", []string{"openid", "profile", "email", "groups"}),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoleMapping:  getListEnv("OIDC_ROLE_MAPPING", nil),
+
+		SCIMToken:       getEnv("SCIM_TOKEN", ""),
+		SCIMDefaultRole: getEnv("SCIM_DEFAULT_ROLE", "tpm"),
 	}
 }
 
@@ -22,3 +133,44 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getIntEnv(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getListEnv(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	service *services.AuthService
+}
+
+func NewAPIKeyHandler(service *services.AuthService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(c.GetUint("userID"), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrAPIKeyNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "allowed_scopes": services.APIKeyScopes})
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.service.ListAPIKeys(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]gin.H, len(keys))
+	for i := range keys {
+		resp[i] = gin.H{
+			"id":           keys[i].ID,
+			"name":         keys[i].Name,
+			"prefix":       keys[i].Prefix,
+			"scopes":       keys[i].ScopeList(),
+			"created_at":   keys[i].CreatedAt,
+			"expires_at":   keys[i].ExpiresAt,
+			"last_used_at": keys[i].LastUsedAt,
+			"revoked_at":   keys[i].RevokedAt,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.service.RevokeAPIKey(c.GetUint("userID"), uint(id)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
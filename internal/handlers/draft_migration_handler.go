@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// draftMigrationView shows a migration report with its applied mappings and
+// validation errors decoded.
+type draftMigrationView struct {
+	*models.DraftMigration
+	Changes json.RawMessage `json:"changes"`
+	Errors  json.RawMessage `json:"errors,omitempty"`
+}
+
+func newDraftMigrationView(r *models.DraftMigration) draftMigrationView {
+	view := draftMigrationView{DraftMigration: r, Changes: json.RawMessage("[]")}
+	if r.Changes != "" {
+		view.Changes = json.RawMessage(r.Changes)
+	}
+	if r.Errors != "" {
+		view.Errors = json.RawMessage(r.Errors)
+	}
+	return view
+}
+
+func newDraftMigrationViews(reports []models.DraftMigration) []draftMigrationView {
+	views := make([]draftMigrationView, len(reports))
+	for i := range reports {
+		views[i] = newDraftMigrationView(&reports[i])
+	}
+	return views
+}
+
+type DraftMigrationHandler struct {
+	service *services.DraftMigrationService
+}
+
+func NewDraftMigrationHandler(service *services.DraftMigrationService) *DraftMigrationHandler {
+	return &DraftMigrationHandler{service: service}
+}
+
+// MigrateDrafts starts moving a form's drafts to the :version it names,
+// which must be current, and returns the run. With {"dry_run": true} it
+// only reports what would happen.
+func (h *DraftMigrationHandler) MigrateDrafts(c *gin.Context) {
+	version, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	run, err := h.service.StartMigration(models.FormType(c.Param("type")), version, c.GetUint("userID"), req.DryRun)
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+}
+
+// GetRun returns a migration run with its counts so far.
+func (h *DraftMigrationHandler) GetRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("run"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+		return
+	}
+	run, err := h.service.GetRun(models.FormType(c.Param("type")), uint(id))
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// ListReports pages through the reports of a migration run with limit and
+// offset.
+func (h *DraftMigrationHandler) ListReports(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("run"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	reports, err := h.service.Reports(models.FormType(c.Param("type")), uint(id), limit, offset)
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newDraftMigrationViews(reports))
+}
+
+// ListForSubmission returns the migration reports of a submission.
+func (h *DraftMigrationHandler) ListForSubmission(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	reports, err := h.service.ForSubmission(uint(id), c.GetUint("userID"), getRole(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newDraftMigrationViews(reports))
+}
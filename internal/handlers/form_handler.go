@@ -1,63 +1,282 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"rcs-onboarding/internal/models"
 	"rcs-onboarding/internal/services"
+	"rcs-onboarding/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// formVersionView adds the decoded schema, business rules and field
+// mappings to a version, so clients can read field rules and conditions
+// without parsing the stored JSON.
+type formVersionView struct {
+	*models.FormVersion
+	Fields   []models.Field        `json:"fields"`
+	Rules    []models.Rule         `json:"rules"`
+	Mappings []models.FieldMapping `json:"mappings"`
+}
+
+func newFormVersionView(v *models.FormVersion) (*formVersionView, error) {
+	fields, err := v.Fields()
+	if err != nil {
+		return nil, err
+	}
+	rules, err := v.DecodeRules()
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := v.DecodeMappings()
+	if err != nil {
+		return nil, err
+	}
+	return &formVersionView{FormVersion: v, Fields: fields, Rules: rules, Mappings: mappings}, nil
+}
+
 type FormHandler struct {
 	service *services.FormService
+	access  *services.PolicyService
 }
 
-func NewFormHandler(service *services.FormService) *FormHandler {
-	return &FormHandler{service: service}
+func NewFormHandler(service *services.FormService, access *services.PolicyService) *FormHandler {
+	return &FormHandler{service: service, access: access}
 }
 
+// Create stores a new draft version. With "publish": true it is published
+// straight away, or from "effective_at" when that is given.
 func (h *FormHandler) Create(c *gin.Context) {
 	formType := models.FormType(c.Param("type"))
 	var req struct {
-		Schema []models.Field `json:"schema" binding:"required"`
+		services.FormDefinition
+		Publish     bool       `json:"publish"`
+		EffectiveAt *time.Time `json:"effective_at"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema: " + err.Error()})
 		return
 	}
 
-	// Basic validation (extend as needed)
-	if len(req.Schema) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Schema cannot be empty"})
+	var newVersion *models.FormVersion
+	var err error
+	if req.Publish {
+		newVersion, err = h.service.CreatePublished(formType, req.FormDefinition, req.EffectiveAt)
+	} else {
+		newVersion, err = h.service.Create(formType, req.FormDefinition)
+	}
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	respondFormVersion(c, http.StatusCreated, newVersion)
+}
+
+// UpdateDraft replaces the schema, rules and policy of a draft version.
+func (h *FormHandler) UpdateDraft(c *gin.Context) {
+	version, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	var req services.FormDefinition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema: " + err.Error()})
 		return
 	}
 
-	newVersion, err := h.service.Create(formType, req.Schema)
+	form, err := h.service.UpdateDraft(models.FormType(c.Param("type")), version, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondFormError(c, err)
+		return
+	}
+	respondFormVersion(c, http.StatusOK, form)
+}
+
+func (h *FormHandler) Publish(c *gin.Context) {
+	version, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		EffectiveAt *time.Time `json:"effective_at"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	form, err := h.service.Publish(models.FormType(c.Param("type")), version, req.EffectiveAt)
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	respondFormVersion(c, http.StatusOK, form)
+}
+
+func (h *FormHandler) Retire(c *gin.Context) {
+	version, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	form, err := h.service.Retire(models.FormType(c.Param("type")), version)
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	respondFormVersion(c, http.StatusOK, form)
+}
+
+// Validate lints a form definition without publishing it. When the body
+// also carries sample "data", the data is validated against the definition
+// as a submission would be.
+func (h *FormHandler) Validate(c *gin.Context) {
+	formType := models.FormType(c.Param("type"))
+	var req struct {
+		services.FormDefinition
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, newVersion)
+	result, err := h.service.DryRun(formType, req.FormDefinition, string(req.Data))
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
 }
 
+// ListVersions lists a form's versions, newest first. Drafts are only shown
+// to those who can publish.
 func (h *FormHandler) ListVersions(c *gin.Context) {
 	formType := models.FormType(c.Param("type"))
-	templates, err := h.service.ListVersions(formType)
+	includeDrafts := h.access.Can(getRole(c), models.PermFormPublish)
+	templates, err := h.service.ListVersions(formType, includeDrafts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, templates)
+	views := make([]*formVersionView, 0, len(templates))
+	for i := range templates {
+		view, err := newFormVersionView(&templates[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		views = append(views, view)
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func (h *FormHandler) GetVersion(c *gin.Context) {
+	version, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	form, err := h.service.GetVersion(models.FormType(c.Param("type")), version)
+	if err == nil && form.Status == models.FormVersionDraft && !h.access.Can(getRole(c), models.PermFormPublish) {
+		err = services.ErrFormVersionNotFound
+	}
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	respondFormVersion(c, http.StatusOK, form)
+}
+
+// Diff compares the :version and :other versions of a form, e.g.
+// /forms/qualification/versions/2/diff/3 lists what changed in version 3.
+func (h *FormHandler) Diff(c *gin.Context) {
+	from, ok := parseFormVersion(c)
+	if !ok {
+		return
+	}
+	to, err := strconv.Atoi(c.Param("other"))
+	if err != nil || to <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+	formType := models.FormType(c.Param("type"))
+
+	// Drafts stay hidden from those who cannot publish.
+	if !h.access.Can(getRole(c), models.PermFormPublish) {
+		for _, v := range []int{from, to} {
+			form, err := h.service.GetVersion(formType, v)
+			if err == nil && form.Status == models.FormVersionDraft {
+				respondFormError(c, services.ErrFormVersionNotFound)
+				return
+			}
+		}
+	}
+
+	diff, err := h.service.Diff(formType, from, to)
+	if err != nil {
+		respondFormError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
 }
 
+// GetLatest returns the version submissions currently bind to.
 func (h *FormHandler) GetLatest(c *gin.Context) {
 	formType := models.FormType(c.Param("type"))
-	template, err := h.service.GetLatest(formType)
+	template, err := h.service.GetCurrent(formType)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	c.JSON(http.StatusOK, template)
+	respondFormVersion(c, http.StatusOK, template)
+}
+
+func parseFormVersion(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return 0, false
+	}
+	return version, true
+}
+
+func respondFormVersion(c *gin.Context, status int, form *models.FormVersion) {
+	view, err := newFormVersionView(form)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, view)
+}
+
+// respondFormError maps errors from managing form versions; schema problems
+// are listed in full.
+func respondFormError(c *gin.Context, err error) {
+	var schemaErr *utils.SchemaError
+	switch {
+	case errors.As(err, &schemaErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schema", "problems": schemaErr.Problems})
+	case errors.Is(err, services.ErrInvalidSchema), errors.Is(err, services.ErrEffectiveTooEarly):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFormTypeNotFound), errors.Is(err, services.ErrFormVersionNotFound),
+		errors.Is(err, services.ErrNoPublishedVersion), errors.Is(err, services.ErrMigrationRunNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDraftExists), errors.Is(err, services.ErrNotDraft),
+		errors.Is(err, services.ErrVersionInUse), errors.Is(err, services.ErrVersionRetired),
+		errors.Is(err, services.ErrNotCurrentVersion):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListFormats returns the named formats schema fields can reference.
+func (h *FormHandler) ListFormats(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.Formats())
 }
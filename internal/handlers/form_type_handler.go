@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FormTypeHandler struct {
+	service *services.FormTypeService
+	access  *services.PolicyService
+}
+
+func NewFormTypeHandler(service *services.FormTypeService, access *services.PolicyService) *FormTypeHandler {
+	return &FormTypeHandler{service: service, access: access}
+}
+
+// List returns every form type to those who manage them and only enabled
+// ones to everyone else.
+func (h *FormTypeHandler) List(c *gin.Context) {
+	enabledOnly := !h.access.Can(getRole(c), models.PermFormTypeManage)
+	formTypes, err := h.service.List(enabledOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, formTypes)
+}
+
+func (h *FormTypeHandler) Get(c *gin.Context) {
+	formType, err := h.service.View(models.FormType(c.Param("key")))
+	if err != nil {
+		c.JSON(formTypeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, formType)
+}
+
+func (h *FormTypeHandler) Create(c *gin.Context) {
+	var req struct {
+		Key models.FormType `json:"key" binding:"required"`
+		services.FormTypeInput
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	formType, err := h.service.Create(req.Key, req.FormTypeInput)
+	if err != nil {
+		c.JSON(formTypeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, formType)
+}
+
+func (h *FormTypeHandler) Update(c *gin.Context) {
+	var req services.FormTypeInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	formType, err := h.service.Update(models.FormType(c.Param("key")), req)
+	if err != nil {
+		c.JSON(formTypeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, formType)
+}
+
+func formTypeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFormTypeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrFormTypeExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
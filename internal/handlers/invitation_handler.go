@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationHandler struct {
+	service *services.InvitationService
+}
+
+func NewInvitationHandler(service *services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{service: service}
+}
+
+func (h *InvitationHandler) Create(c *gin.Context) {
+	var req struct {
+		Email          string `json:"email" binding:"required"`
+		OrganizationID uint   `json:"organization_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite, err := h.service.Create(c.GetUint("userID"), req.Email, req.OrganizationID)
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, invite)
+}
+
+func (h *InvitationHandler) List(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	invites, err := h.service.List(c.Query("pending") == "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation id"})
+		return
+	}
+	if err := h.service.Revoke(uint(id)); err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *InvitationHandler) Register(c *gin.Context) {
+	var req struct {
+		Code     string `json:"code" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.Register(req.Code, req.Username, req.Password)
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"user": user, "message": "check your email to verify your address"})
+}
+
+// VerifyEmail accepts the token as a query parameter (the emailed link) or in
+// a JSON body.
+func (h *InvitationHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var req struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token = req.Token
+	}
+
+	if _, err := h.service.VerifyEmail(token); err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+func (h *InvitationHandler) ResendVerification(c *gin.Context) {
+	if err := h.service.ResendVerification(c.GetUint("userID")); err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+func invitationErrorStatus(err error) int {
+	var policyErr *services.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrOrganizationNotFound),
+		errors.Is(err, services.ErrInvitationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrUsernameTaken),
+		errors.Is(err, services.ErrEmailAlreadyVerified):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrInvitationInvalid),
+		errors.Is(err, services.ErrInvalidToken):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
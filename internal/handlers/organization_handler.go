@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationHandler struct {
+	service *services.OrganizationService
+}
+
+func NewOrganizationHandler(service *services.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{service: service}
+}
+
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := h.service.Create(req.Name)
+	if err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+func (h *OrganizationHandler) List(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	orgs, err := h.service.List(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+func (h *OrganizationHandler) Members(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+	members, err := h.service.Members(id)
+	if err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.AddMember(id, req.UserID); err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "member added"})
+}
+
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.service.RemoveMember(id, uint(userID)); err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func parseOrganizationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func organizationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrNotMember):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrganizationExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrNotCustomer):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	service *services.PolicyService
+}
+
+func NewRoleHandler(service *services.PolicyService) *RoleHandler {
+	return &RoleHandler{service: service}
+}
+
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Permissions)
+}
+
+func (h *RoleHandler) List(c *gin.Context) {
+	roles, err := h.service.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *RoleHandler) Create(c *gin.Context) {
+	var req struct {
+		Name        models.Role         `json:"name" binding:"required"`
+		Description string              `json:"description"`
+		Permissions []models.Permission `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.service.CreateRole(req.Name, req.Description, req.Permissions)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *RoleHandler) SetPermissions(c *gin.Context) {
+	var req struct {
+		Permissions []models.Permission `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetPermissions(models.Role(c.Param("role")), req.Permissions); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": c.Param("role"), "permissions": req.Permissions})
+}
+
+func (h *RoleHandler) Delete(c *gin.Context) {
+	if err := h.service.DeleteRole(models.Role(c.Param("role"))); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrBuiltinRole), errors.Is(err, services.ErrLockout):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
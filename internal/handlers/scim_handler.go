@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	service *services.SCIMService
+}
+
+func NewSCIMHandler(service *services.SCIMService) *SCIMHandler {
+	return &SCIMHandler{service: service}
+}
+
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	respondSCIM(c, http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": 200},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Static token configured with SCIM_TOKEN",
+		}},
+	})
+}
+
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	startIndex, count := scimPaging(c)
+	list, err := h.service.ListUsers(c.Query("filter"), startIndex, count)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.service.GetUser(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req services.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	user, err := h.service.CreateUser(req)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusCreated, user)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req services.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	user, err := h.service.ReplaceUser(c.Param("id"), req)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req services.SCIMPatch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	user, err := h.service.PatchUser(c.Param("id"), req)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.service.DeleteUser(c.Param("id")); err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	startIndex, count := scimPaging(c)
+	list, err := h.service.ListGroups(c.Query("filter"), startIndex, count)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.service.GetGroup(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var req services.SCIMGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	group, err := h.service.ReplaceGroup(c.Param("id"), req)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req services.SCIMPatch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	group, err := h.service.PatchGroup(c.Param("id"), req)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, group)
+}
+
+// GroupsNotManaged answers group creation and deletion: groups are the
+// application's roles, which are managed under /api/v1/roles.
+func (h *SCIMHandler) GroupsNotManaged(c *gin.Context) {
+	respondSCIMError(c, &services.SCIMError{Status: http.StatusForbidden, ScimType: "mutability", Detail: "groups mirror roles; manage roles in the application"})
+}
+
+func scimPaging(c *gin.Context) (int, int) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	count, _ := strconv.Atoi(c.Query("count"))
+	return startIndex, count
+}
+
+func respondSCIM(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+func respondSCIMError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	scimType := ""
+	var scimErr *services.SCIMError
+	switch {
+	case errors.As(err, &scimErr):
+		status, scimType = scimErr.Status, scimErr.ScimType
+	case errors.Is(err, services.ErrUserNotFound):
+		status = http.StatusNotFound
+	}
+	body := gin.H{
+		"schemas": []string{services.SCIMErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  err.Error(),
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	c.Header("Content-Type", scimContentType)
+	c.AbortWithStatusJSON(status, body)
+}
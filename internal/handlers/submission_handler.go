@@ -2,39 +2,30 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"rcs-onboarding/internal/models"
 	"rcs-onboarding/internal/services"
+	"rcs-onboarding/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type SubmissionHandler struct {
-	subService   *services.SubmissionService
-	auditService *services.AuditService
+	subService *services.SubmissionService
 }
 
-func NewSubmissionHandler(subService *services.SubmissionService, auditService *services.AuditService) *SubmissionHandler {
-	return &SubmissionHandler{subService: subService, auditService: auditService}
+func NewSubmissionHandler(subService *services.SubmissionService) *SubmissionHandler {
+	return &SubmissionHandler{subService: subService}
 }
 
-// ... (imports remain the same)
-
+// Submit creates a submission of the form type in the "id" param, which must
+// be registered, enabled and open to the caller's role.
 func (h *SubmissionHandler) Submit(c *gin.Context) {
-	formTypeStr := c.Param("id") // Now using "id" as the param key
-	var formType models.FormType
-	switch formTypeStr {
-	case "customer_order":
-		formType = models.CustomerOrder
-	case "qualification":
-		formType = models.Qualification
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid form type"})
-		return
-	}
-
+	formType := models.FormType(c.Param("id"))
 	userID := c.GetUint("userID")
 
 	var req struct {
@@ -46,16 +37,16 @@ func (h *SubmissionHandler) Submit(c *gin.Context) {
 		return
 	}
 
-	sub, err := h.subService.Submit(formType, userID, string(req.Data), req.IsDraft)
+	var entry *models.AuditLog
+	if !req.IsDraft {
+		entry = auditEntry(c, "Submitted", "Initial submission")
+	}
+	sub, err := h.subService.Submit(formType, userID, getRole(c), string(req.Data), req.IsDraft, entry)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWriteError(c, err)
 		return
 	}
 
-	if !req.IsDraft {
-		h.auditService.CreateAudit(sub.ID, userID, "Submitted", "Initial submission")
-	}
-
 	c.JSON(http.StatusCreated, sub)
 }
 
@@ -77,7 +68,12 @@ func (h *SubmissionHandler) Review(c *gin.Context) {
 		return
 	}
 
-	err = h.subService.Review(uint(id), userID, req.Status, req.Remarks)
+	entry := auditEntry(c, fmt.Sprintf("Status changed to %s", req.Status), req.Remarks)
+	err = h.subService.Review(uint(id), userID, getRole(c), req.Status, entry)
+	if errors.Is(err, services.ErrFormTypeNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -96,36 +92,59 @@ func (h *SubmissionHandler) UpdateDraft(c *gin.Context) {
 	userID := c.GetUint("userID")
 
 	var req struct {
-		Data json.RawMessage `json:"data"`
+		Data    json.RawMessage `json:"data"`
+		Version int             `json:"version"` // the version data is for; defaults to the one the draft is saved on
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	sub, err := h.subService.UpdateDraft(uint(id), userID, string(req.Data))
+	sub, err := h.subService.UpdateDraft(uint(id), userID, getRole(c), string(req.Data), req.Version,
+		auditEntry(c, "Updated Draft", "Draft updated"))
+	if err != nil {
+		respondWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// SetPinned pins a draft to its form version, or unpins it, from
+// {"pinned": true|false}.
+func (h *SubmissionHandler) SetPinned(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	h.auditService.CreateAudit(sub.ID, userID, "Updated Draft", "Draft updated")
+	entry := auditEntry(c, "Unpinned Draft", "Draft follows the current version")
+	if req.Pinned {
+		entry = auditEntry(c, "Pinned Draft", "")
+	}
+	sub, err := h.subService.SetPinned(uint(id), c.GetUint("userID"), getRole(c), req.Pinned, entry)
+	if err != nil {
+		respondWriteError(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, sub)
 }
 
 func (h *SubmissionHandler) GetFiltered(c *gin.Context) {
 	userID := c.GetUint("userID")
-	role := models.Role(c.GetString("role"))
+	role := getRole(c)
 
-	var customerID *uint
-	if cidStr := c.Query("customer_id"); cidStr != "" && role == models.Admin {
-		cid64, err := strconv.ParseUint(cidStr, 10, 32)
-		if err == nil {
-			cid := uint(cid64)
-			customerID = &cid
-		}
-	}
+	customerID := getUintPtr(c.Query("customer_id"))
+	organizationID := getUintPtr(c.Query("organization_id"))
 
 	status := getStringPtr(c.Query("status"))
 	startDate := getStringPtr(c.Query("start_date"))
@@ -133,7 +152,11 @@ func (h *SubmissionHandler) GetFiltered(c *gin.Context) {
 	limit := c.Query("limit")
 	offset := c.Query("offset")
 
-	subs, err := h.subService.GetFiltered(userID, role, customerID, status, startDate, endDate, limit, offset)
+	subs, err := h.subService.GetFiltered(userID, role, customerID, organizationID, status, startDate, endDate, limit, offset)
+	if errors.Is(err, services.ErrNoOrganization) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -150,7 +173,7 @@ func (h *SubmissionHandler) GetByID(c *gin.Context) {
 		return
 	}
 	userID := c.GetUint("userID")
-	role := models.Role(c.GetString("role"))
+	role := getRole(c)
 
 	sub, err := h.subService.GetByID(uint(id), userID, role)
 	if err != nil {
@@ -167,3 +190,50 @@ func getStringPtr(s string) *string {
 	}
 	return &s
 }
+
+func getUintPtr(s string) *uint {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil
+	}
+	u := uint(v)
+	return &u
+}
+
+// getRole reads the role set by AuthMiddleware, which is stored as models.Role
+// rather than a plain string.
+func getRole(c *gin.Context) models.Role {
+	role, _ := c.Get("role")
+	r, _ := role.(models.Role)
+	return r
+}
+
+// respondWriteError maps errors from creating or editing a submission;
+// validation failures list every problem so the form can be fixed in one go.
+func respondWriteError(c *gin.Context, err error) {
+	var validationErr *utils.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "errors": validationErr.Errors})
+	case errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, services.ErrNoOrganization),
+		errors.Is(err, services.ErrFormTypeDisabled), errors.Is(err, services.ErrFormTypeNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPinnedRetired), errors.Is(err, services.ErrNoPublishedVersion),
+		errors.Is(err, services.ErrDataVersion):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// auditEntry describes a submission action for the service to store with
+// it. Every action is named here, not in the service, so the entry can be
+// attributed to the real actor when an admin is impersonating.
+func auditEntry(c *gin.Context, action string, remarks string) *models.AuditLog {
+	userID := c.GetUint("userID")
+	entry := &models.AuditLog{UserID: userID, Action: action, Remarks: remarks}
+	if impersonatorID := c.GetUint("impersonatorID"); impersonatorID != 0 {
+		entry.UserID, entry.OnBehalfOfID = impersonatorID, userID
+	}
+	return entry
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// AuditImpersonation records every request made with an impersonation token,
+// attributed to the real admin. It must wrap the auth middleware so the
+// context keys are populated by the time the request finishes.
+func AuditImpersonation(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		actorID := c.GetUint("impersonatorID")
+		if actorID == 0 {
+			return
+		}
+		var submissionID uint
+		if strings.HasPrefix(c.FullPath(), "/api/v1/submissions/:id") {
+			if id, err := strconv.ParseUint(c.Param("id"), 10, 32); err == nil {
+				submissionID = uint(id)
+			}
+		}
+		remarks := fmt.Sprintf("%s %s -> %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+		if err := audit.Record(submissionID, actorID, c.GetUint("userID"), "Impersonated Request", remarks); err != nil {
+			log.Error().Err(err).Uint("actor", actorID).Msg("Failed to audit impersonated request")
+		}
+	}
+}
@@ -1,54 +1,88 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"rcs-onboarding/internal/config"
 	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
-	cfg := config.LoadConfig()
+// mfaEnrollmentRoutes are all a session may use until its user, whose role
+// requires two-factor, has enrolled.
+var mfaEnrollmentRoutes = map[string]bool{
+	"/api/v1/auth/mfa/enroll":  true,
+	"/api/v1/auth/mfa/confirm": true,
+	"/api/v1/auth/logout":      true,
+}
+
+func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		apiKey := c.GetHeader("X-API-Key")
+		if authHeader == "" && apiKey == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
+		if apiKey == "" && len(parts) == 2 && parts[0] == "ApiKey" {
+			apiKey = parts[1]
+		}
+		if apiKey != "" {
+			authenticateAPIKey(c, authService, apiKey)
+			return
+		}
+
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid auth header"})
 			return
 		}
 
-		tokenStr := parts[1]
-		claims := &struct {
-			UserID uint        `json:"user_id"`
-			Role   models.Role `json:"role"`
-			jwt.RegisteredClaims
-		}{}
-
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return cfg.JWTKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := authService.ValidateToken(parts[1])
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 
+		if claims.MFAPending && !mfaEnrollmentRoutes[c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "two-factor enrollment required", "mfa_enrollment_required": true})
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
+		if claims.ActorID != 0 {
+			c.Set("impersonatorID", claims.ActorID)
+			c.Header("X-Impersonated-By", strconv.FormatUint(uint64(claims.ActorID), 10))
+		}
 		c.Next()
 	}
 }
 
-func RoleMiddleware(roles ...models.Role) gin.HandlerFunc {
+func authenticateAPIKey(c *gin.Context, authService *services.AuthService, raw string) {
+	key, user, err := authService.ValidateAPIKey(raw, c.Request.Method, c.FullPath())
+	if errors.Is(err, services.ErrScopeDenied) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("role", user.Role)
+	c.Set("apiKeyID", key.ID)
+	c.Next()
+}
+
+func RequirePermission(access *services.PolicyService, perm models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roleValue, exists := c.Get("role")
 		if !exists {
@@ -60,15 +94,20 @@ func RoleMiddleware(roles ...models.Role) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid role type"})
 			return
 		}
-		allowed := false
-		for _, r := range roles {
-			if role == r {
-				allowed = true
-				break
-			}
+		if !access.CanAct(role, perm, c.GetUint("impersonatorID") != 0) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "missing_permission": perm})
+			return
 		}
-		if !allowed {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		c.Next()
+	}
+}
+
+// DenyImpersonation guards self-service account routes (passwords, MFA) that
+// an admin acting as someone else must not touch.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("impersonatorID") != 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating"})
 			return
 		}
 		c.Next()
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"rcs-onboarding/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuth admits only the provisioning client holding the configured bearer
+// token. It is separate from user authentication on purpose: the token acts
+// for the identity provider, not for any account.
+func SCIMAuth(token string) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		sum := sha256.Sum256([]byte(got))
+		if !ok || subtle.ConstantTimeCompare(sum[:], want[:]) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{services.SCIMErrorSchema},
+				"status":  "401",
+				"detail":  "invalid SCIM token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
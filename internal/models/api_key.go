@@ -0,0 +1,31 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKey struct {
+	gorm.Model
+	UserID     uint   `gorm:"index"`
+	Name       string `gorm:"size:100"`
+	Prefix     string `gorm:"size:16;uniqueIndex"` // Visible part of the key, used for lookup
+	KeyHash    string `gorm:"size:64" json:"-"`
+	Scopes     string `gorm:"type:text" json:"-"` // Newline-separated "METHOD /route" entries
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, "\n")
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
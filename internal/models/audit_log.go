@@ -5,7 +5,8 @@ import "gorm.io/gorm"
 type AuditLog struct {
 	gorm.Model
 	SubmissionID uint
-	UserID       uint
+	UserID       uint // The real actor, even while impersonating
+	OnBehalfOfID uint // Impersonated user, 0 for direct actions
 	Action       string
 	Remarks      string
 }
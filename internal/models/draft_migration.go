@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outcomes of migrating a draft.
+const (
+	MigrationMigrated = "migrated"
+	MigrationFailed   = "failed"
+)
+
+// States of a migration run.
+const (
+	MigrationRunRunning   = "running"
+	MigrationRunCompleted = "completed"
+	MigrationRunFailed    = "failed" // stopped by an error; see Error
+)
+
+// MigrationRun is one background job moving a form's drafts to its current
+// version. The counts grow as it goes.
+type MigrationRun struct {
+	gorm.Model
+	FormType   FormType   `json:"form_type"`
+	Version    int        `json:"version"`
+	DryRun     bool       `json:"dry_run"`
+	Status     string     `gorm:"size:16" json:"status"`
+	Migrated   int        `json:"migrated"`
+	Failed     int        `json:"failed"`
+	Pinned     int        `json:"pinned"` // drafts left on their version
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	RunBy      uint       `json:"run_by"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// DraftMigration reports one attempt to move a draft submission to a newer
+// form version. Failed drafts keep their data and version.
+type DraftMigration struct {
+	gorm.Model
+	RunID        uint     `gorm:"index" json:"run_id"`
+	SubmissionID uint     `gorm:"index" json:"submission_id"`
+	FormType     FormType `json:"form_type"`
+	FromVersion  int      `json:"from_version"`
+	ToVersion    int      `json:"to_version"`
+	Status       string   `gorm:"size:16" json:"status"`
+	Changes      string   `gorm:"type:text" json:"-"` // JSON list of applied mappings
+	Errors       string   `gorm:"type:text" json:"-"` // JSON list of validation errors
+	RunBy        uint     `json:"run_by"`
+}
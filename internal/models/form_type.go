@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FormTypeDefinition registers a kind of form that can be published and
+// submitted. Disabled types keep their versions and submissions but accept
+// no new submissions.
+type FormTypeDefinition struct {
+	gorm.Model
+	Key            FormType `gorm:"size:64;unique" json:"key"`
+	DisplayName    string   `gorm:"size:191" json:"display_name"`
+	Description    string   `gorm:"size:1000" json:"description"`
+	SubmitterRoles string   `gorm:"type:text" json:"-"` // Newline-separated roles; empty allows any role with submission.create
+	ReviewerRoles  string   `gorm:"type:text" json:"-"` // Newline-separated roles; empty allows any role with submission.review
+	Enabled        bool     `json:"enabled"`
+}
+
+func (t *FormTypeDefinition) Submitters() []Role {
+	return splitRoles(t.SubmitterRoles)
+}
+
+func (t *FormTypeDefinition) Reviewers() []Role {
+	return splitRoles(t.ReviewerRoles)
+}
+
+// AllowsSubmitter reports whether role may create submissions of this type.
+func (t *FormTypeDefinition) AllowsSubmitter(role Role) bool {
+	return allowsRole(t.Submitters(), role)
+}
+
+// AllowsReviewer reports whether role may review submissions of this type.
+func (t *FormTypeDefinition) AllowsReviewer(role Role) bool {
+	return allowsRole(t.Reviewers(), role)
+}
+
+func JoinRoles(roles []Role) string {
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = string(r)
+	}
+	return strings.Join(names, "\n")
+}
+
+func splitRoles(s string) []Role {
+	if s == "" {
+		return []Role{}
+	}
+	parts := strings.Split(s, "\n")
+	roles := make([]Role, len(parts))
+	for i, p := range parts {
+		roles[i] = Role(p)
+	}
+	return roles
+}
+
+func allowsRole(roles []Role, role Role) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
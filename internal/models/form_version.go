@@ -1,19 +1,141 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FormVersionStatus is where a version is in its lifecycle. Drafts are
+// editable and unused. A published version takes effect at EffectiveAt and
+// stays current until a later published version takes effect, which makes
+// it deprecated. Retired versions are withdrawn for good.
+type FormVersionStatus string
+
+const (
+	FormVersionDraft      FormVersionStatus = "draft"
+	FormVersionPublished  FormVersionStatus = "published"
+	FormVersionDeprecated FormVersionStatus = "deprecated"
+	FormVersionRetired    FormVersionStatus = "retired"
+)
 
 type FormVersion struct {
 	gorm.Model
-	Type    FormType `gorm:"index"`
-	Version int      `gorm:"index"`
-	Schema  string   `gorm:"type:text"` // JSON []Field
+	Type          FormType          `gorm:"uniqueIndex:idx_form_type_version"`
+	Version       int               `gorm:"uniqueIndex:idx_form_type_version"`
+	Schema        string            `gorm:"type:text"` // JSON []Field
+	UnknownFields string            `gorm:"size:16;default:keep" json:"unknown_fields"`
+	Rules         string            `gorm:"type:text" json:"-"` // JSON []Rule
+	Mappings      string            `gorm:"type:text" json:"-"` // JSON []FieldMapping
+	Status        FormVersionStatus `gorm:"size:16;index;default:published" json:"status"`
+	EffectiveAt   *time.Time        `json:"effective_at"` // Set on publish; may be in the future
+	PublishedAt   *time.Time        `json:"published_at"`
+}
+
+// Rule is a cross-field business rule: Expr must evaluate to true for the
+// submission to be accepted, otherwise Message is reported on Field (a
+// path, or empty for the whole submission).
+type Rule struct {
+	Name    string `json:"name"`
+	Expr    string `json:"expr"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// Field mapping operations.
+const (
+	MappingRename    = "rename"
+	MappingDefault   = "default"
+	MappingDrop      = "drop"
+	MappingTransform = "transform"
+)
+
+// FieldMapping is one step that moves draft data from the previous
+// version's shape to this version's. A version's mappings run in order when
+// a draft is migrated to it. Field and To are dotted paths.
+type FieldMapping struct {
+	Op    string      `json:"op"`              // rename, default, drop or transform
+	Field string      `json:"field"`           // the value the mapping reads or changes
+	To    string      `json:"to,omitempty"`    // rename: the new path
+	Value interface{} `json:"value,omitempty"` // default: set when Field is missing or null
+	Expr  string      `json:"expr,omitempty"`  // transform: rule expression whose result replaces Field
+}
+
+// Policies for submitted keys that the schema does not define, applied at
+// every object level.
+const (
+	UnknownFieldsKeep   = "keep"   // store them as sent
+	UnknownFieldsStrip  = "strip"  // drop them silently
+	UnknownFieldsReject = "reject" // fail validation
+)
+
+// Fields decodes the stored schema.
+func (f *FormVersion) Fields() ([]Field, error) {
+	var fields []Field
+	err := json.Unmarshal([]byte(f.Schema), &fields)
+	return fields, err
 }
 
+// DecodeRules decodes the stored business rules.
+func (f *FormVersion) DecodeRules() ([]Rule, error) {
+	var rules []Rule
+	if f.Rules == "" {
+		return rules, nil
+	}
+	err := json.Unmarshal([]byte(f.Rules), &rules)
+	return rules, err
+}
+
+// DecodeMappings decodes the stored field mappings.
+func (f *FormVersion) DecodeMappings() ([]FieldMapping, error) {
+	var mappings []FieldMapping
+	if f.Mappings == "" {
+		return mappings, nil
+	}
+	err := json.Unmarshal([]byte(f.Mappings), &mappings)
+	return mappings, err
+}
+
+// Field types: string, int, url, email, lookup, date, datetime, boolean,
+// decimal, phone, color, multi_lookup, language, country, and the composite
+// object (Fields) and array (Items) types.
 type Field struct {
 	Name     string   `json:"name"`
-	Type     string   `json:"type"` // string, int, url, email, lookup
+	Type     string   `json:"type"`
 	Required bool     `json:"required"`
-	Max      int      `json:"max,omitempty"`
+	Max      int      `json:"max,omitempty"` // length, value, or item count for multi_lookup and array
 	Min      int      `json:"min,omitempty"`
 	Options  []string `json:"options,omitempty"`
+
+	MinDate   string `json:"min_date,omitempty"` // date/datetime bounds: YYYY-MM-DD or RFC 3339
+	MaxDate   string `json:"max_date,omitempty"`
+	Precision int    `json:"precision,omitempty"` // decimal: max digits after the point, 0 = any
+
+	Pattern string `json:"pattern,omitempty"` // RE2 regular expression string values must match
+	Format  string `json:"format,omitempty"`  // named format from the registry, e.g. ein
+
+	Generate string `json:"generate,omitempty"` // named generator that fills the value when it is not sent, e.g. sid
+
+	// Conditions on other values of the same object. A field whose
+	// visible_if does not hold is not validated and its value is dropped.
+	RequiredIf  *Condition `json:"required_if,omitempty"`
+	VisibleIf   *Condition `json:"visible_if,omitempty"`
+	ForbiddenIf *Condition `json:"forbidden_if,omitempty"`
+
+	Fields []Field `json:"fields,omitempty"` // object: the sub-fields
+	Items  *Field  `json:"items,omitempty"`  // array: schema of every item
+}
+
+// Condition tests another field's value. Field names a sibling, or a value
+// inside a sibling object as a dotted path (address.country). Exactly one
+// operator is set; comparisons ignore case, and a missing value satisfies
+// only not_equals, not_in and present: false.
+type Condition struct {
+	Field     string        `json:"field"`
+	Equals    interface{}   `json:"equals,omitempty"`
+	NotEquals interface{}   `json:"not_equals,omitempty"`
+	In        []interface{} `json:"in,omitempty"`
+	NotIn     []interface{} `json:"not_in,omitempty"`
+	Present   *bool         `json:"present,omitempty"`
 }
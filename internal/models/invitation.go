@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation lets one customer register into an organization. The code is
+// only ever sent by email and stored hashed.
+type Invitation struct {
+	gorm.Model
+	Email          string `gorm:"size:255;index"`
+	OrganizationID uint   `gorm:"index"`
+	CodeHash       string `gorm:"size:64;uniqueIndex" json:"-"`
+	InvitedBy      uint
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	AcceptedUserID *uint
+	RevokedAt      *time.Time
+}
+
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
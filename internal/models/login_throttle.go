@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginThrottle tracks consecutive failed logins for one key, either
+// "user:<username>" or "ip:<address>".
+type LoginThrottle struct {
+	gorm.Model
+	ThrottleKey   string `gorm:"size:191;uniqueIndex"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TokenPurpose string
+
+const (
+	PasswordResetToken     TokenPurpose = "password_reset"
+	EmailVerificationToken TokenPurpose = "email_verification"
+)
+
+type OneTimeToken struct {
+	gorm.Model
+	UserID    uint         `gorm:"index"`
+	Purpose   TokenPurpose `gorm:"size:32;index"`
+	TokenHash string       `gorm:"size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type PasswordHistory struct {
+	gorm.Model
+	UserID uint   `gorm:"index"`
+	Hash   string `json:"-"`
+}
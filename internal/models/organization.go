@@ -0,0 +1,8 @@
+package models
+
+import "gorm.io/gorm"
+
+type Organization struct {
+	gorm.Model
+	Name string `gorm:"size:191;unique"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Permission string
+
+const (
+	PermFormRead           Permission = "form.read"
+	PermFormPublish        Permission = "form.publish"
+	PermSubmissionCreate   Permission = "submission.create"
+	PermSubmissionReadAll  Permission = "submission.read_all"
+	PermSubmissionReview   Permission = "submission.review"
+	PermAuditRead          Permission = "audit.read"
+	PermUserManage         Permission = "user.manage"
+	PermOrganizationManage Permission = "organization.manage"
+	PermRoleManage         Permission = "role.manage"
+	PermAPIKeyManage       Permission = "api_key.manage"
+	PermUserImpersonate    Permission = "user.impersonate"
+	PermInvitationCreate   Permission = "invitation.create"
+	PermFormTypeManage     Permission = "form_type.manage"
+)
+
+type PermissionInfo struct {
+	Name         Permission `json:"name"`
+	Description  string     `json:"description"`
+	DefaultRoles []Role     `json:"-"`         // Granted when the permission is first introduced
+	Sensitive    bool       `json:"sensitive"` // Never usable by an impersonation session
+}
+
+// Permissions is the catalogue of permissions the code checks.
+var Permissions = []PermissionInfo{
+	{PermFormRead, "View form schemas", []Role{Customer, TPM, Sales, Admin}, false},
+	{PermFormPublish, "Create and publish form versions", []Role{Admin}, true},
+	{PermSubmissionCreate, "Create and edit the organization's submissions", []Role{Customer}, false},
+	{PermSubmissionReadAll, "View submissions of every organization", []Role{TPM, Sales, Admin}, false},
+	{PermSubmissionReview, "Move submissions through review", []Role{TPM, Sales}, true},
+	{PermAuditRead, "Read the audit log", []Role{Admin}, false},
+	{PermUserManage, "Create, disable and delete users", []Role{Admin}, true},
+	{PermOrganizationManage, "Manage organizations and their members", []Role{Admin}, true},
+	{PermRoleManage, "Edit roles and their permissions", []Role{Admin}, true},
+	{PermAPIKeyManage, "Create and use API keys", []Role{Customer}, true},
+	{PermUserImpersonate, "Act as another user for support", []Role{Admin}, true},
+	{PermInvitationCreate, "Invite customers to register", []Role{Sales, Admin}, true},
+	{PermFormTypeManage, "Register form types and set who may submit and review them", []Role{Admin}, true},
+}
+
+func IsKnownPermission(p Permission) bool {
+	return permissionInfo(p) != nil
+}
+
+func IsSensitivePermission(p Permission) bool {
+	info := permissionInfo(p)
+	return info == nil || info.Sensitive
+}
+
+func permissionInfo(p Permission) *PermissionInfo {
+	for i := range Permissions {
+		if Permissions[i].Name == p {
+			return &Permissions[i]
+		}
+	}
+	return nil
+}
+
+type RoleDefinition struct {
+	gorm.Model
+	Name        Role   `gorm:"size:64;unique"`
+	Description string `gorm:"size:255"`
+	Builtin     bool
+}
+
+type RolePermission struct {
+	ID         uint       `gorm:"primaryKey"`
+	Role       Role       `gorm:"size:64;uniqueIndex:idx_role_permission"`
+	Permission Permission `gorm:"size:64;uniqueIndex:idx_role_permission"`
+}
+
+// KnownPermission records which permissions have been seeded, so default
+// grants are applied once and later edits by admins are left alone.
+type KnownPermission struct {
+	Name      Permission `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+}
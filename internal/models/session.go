@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Session struct {
+	gorm.Model
+	UserID            uint   `gorm:"index"`
+	RefreshTokenHash  string `gorm:"size:64;uniqueIndex" json:"-"`
+	PreviousTokenHash string `gorm:"size:64;index" json:"-"` // Last rotated-out token, used for reuse detection
+	ExpiresAt         time.Time
+	RevokedAt         *time.Time
+	ImpersonatorID    uint   // Admin acting as UserID; such sessions cannot be refreshed
+	MFAPending        bool   // Started by a user who must enroll in two-factor; limited to enrollment until they do
+	UserAgent         string `gorm:"size:255"`
+	IP                string `gorm:"size:64"`
+	LastSeenAt        time.Time
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SigningKey struct {
+	gorm.Model
+	Kid        string     `gorm:"size:64;uniqueIndex"`
+	Algorithm  string     `gorm:"size:16"`
+	PrivateKey string     `gorm:"type:text" json:"-"` // "aes-gcm:" + base64(nonce + PKCS#8 PEM sealed under JWT_KEY_ENCRYPTION_KEY)
+	PublicKey  string     `gorm:"type:text"`          // PKIX PEM
+	RetiredAt  *time.Time // No longer used for signing
+	ExpiresAt  *time.Time // No longer accepted for verification
+}
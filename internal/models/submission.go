@@ -4,11 +4,13 @@ import "gorm.io/gorm"
 
 type Submission struct {
 	gorm.Model
-	FormType  FormType
-	Version   int
-	UserID    uint
-	Data      string `gorm:"type:text"` // JSON map[string]any
-	Status    Status
-	CreatedBy uint
-	UpdatedBy uint
+	FormType       FormType
+	Version        int
+	UserID         uint   // Customer who started the submission
+	OrganizationID uint   `gorm:"index"`
+	Data           string `gorm:"type:text"` // JSON map[string]any
+	Status         Status
+	Pinned         bool // A pinned draft stays on Version and is skipped by migrations
+	CreatedBy      uint
+	UpdatedBy      uint
 }
@@ -1,12 +1,44 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique"`
-	Password string // Hashed
+	Password string `json:"-"` // Hashed
 	Role     Role
+	Disabled bool
+
+	OrganizationID *uint `gorm:"index"`
+
+	Email           string `gorm:"size:255;index"`
+	EmailVerifiedAt *time.Time
+
+	AuthProvider string `gorm:"size:32"`        // empty for local password accounts
+	ExternalID   string `gorm:"size:191;index"` // Subject at the identity provider
+	SCIMManaged  bool   // role comes from SCIM groups, not from login claims
+
+	MFAEnabled      bool
+	MFASecret       string `json:"-"`
+	MFALastUsedStep int64  `json:"-"`
+}
+
+// EmailVerified reports whether the user may act on their account's behalf.
+// Accounts created without an email (seeded, SSO, admin-created) have nothing
+// to verify.
+func (u *User) EmailVerified() bool {
+	return u.Email == "" || u.EmailVerifiedAt != nil
+}
+
+type MFARecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"size:64" json:"-"`
+	UsedAt   *time.Time
 }
 
 type FormType string
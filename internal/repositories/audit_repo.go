@@ -17,3 +17,16 @@ func NewAuditRepo(db *gorm.DB) *AuditRepo {
 func (r *AuditRepo) Create(audit *models.AuditLog) error {
 	return r.db.Create(audit).Error
 }
+
+func (r *AuditRepo) FindFiltered(submissionID *uint, userID *uint, limit int, offset int) ([]models.AuditLog, error) {
+	query := r.db.Order("id desc").Limit(limit).Offset(offset)
+	if submissionID != nil {
+		query = query.Where("submission_id = ?", *submissionID)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ? OR on_behalf_of_id = ?", *userID, *userID)
+	}
+	var logs []models.AuditLog
+	err := query.Find(&logs).Error
+	return logs, err
+}
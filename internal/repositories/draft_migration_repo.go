@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type DraftMigrationRepo struct {
+	db *gorm.DB
+}
+
+func NewDraftMigrationRepo(db *gorm.DB) *DraftMigrationRepo {
+	return &DraftMigrationRepo{db: db}
+}
+
+// CreateRun stores a new run. A dry run replaces the reports of the form's
+// earlier dry runs, so only the latest preview is kept.
+func (r *DraftMigrationRepo) CreateRun(run *models.MigrationRun) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if run.DryRun {
+			earlier := tx.Model(&models.MigrationRun{}).Select("id").Where("form_type = ? AND dry_run = ?", run.FormType, true)
+			if err := tx.Unscoped().Where("run_id IN (?)", earlier).Delete(&models.DraftMigration{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(run).Error
+	})
+}
+
+func (r *DraftMigrationRepo) UpdateRun(run *models.MigrationRun) error {
+	return r.db.Save(run).Error
+}
+
+func (r *DraftMigrationRepo) FindRun(id uint) (*models.MigrationRun, error) {
+	var run models.MigrationRun
+	err := r.db.First(&run, id).Error
+	return &run, err
+}
+
+// FindReports pages through the reports of a run in the order they were
+// made.
+func (r *DraftMigrationRepo) FindReports(runID uint, limit int, offset int) ([]models.DraftMigration, error) {
+	var reports []models.DraftMigration
+	err := r.db.Where("run_id = ?", runID).Order("id asc").Limit(limit).Offset(offset).Find(&reports).Error
+	return reports, err
+}
+
+// Create stores the report of a dry run.
+func (r *DraftMigrationRepo) Create(report *models.DraftMigration) error {
+	return r.db.Create(report).Error
+}
+
+// Migrate stores a draft's migrated data and version together with its
+// audit entry and report. It returns false and stores nothing when the
+// draft was edited, submitted or pinned since it was read.
+func (r *DraftMigrationRepo) Migrate(draft *models.Submission, data string, report *models.DraftMigration, audit *models.AuditLog) (bool, error) {
+	migrated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := migrateDraft(tx, draft, data, report.ToVersion, report.RunBy)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := tx.Create(audit).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(report).Error; err != nil {
+			return err
+		}
+		migrated = true
+		return nil
+	})
+	return migrated && err == nil, err
+}
+
+// RecordFailure stores the report of a draft that could not be migrated,
+// replacing the submission's earlier failures so reruns do not pile them up.
+func (r *DraftMigrationRepo) RecordFailure(report *models.DraftMigration) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("submission_id = ? AND status = ?", report.SubmissionID, models.MigrationFailed).
+			Where("run_id NOT IN (?)", dryRuns(tx)).
+			Delete(&models.DraftMigration{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(report).Error
+	})
+}
+
+// FindBySubmission lists the migration reports of a submission, newest
+// first. Dry runs are left out.
+func (r *DraftMigrationRepo) FindBySubmission(submissionID uint) ([]models.DraftMigration, error) {
+	var reports []models.DraftMigration
+	err := r.db.Where("submission_id = ?", submissionID).
+		Where("run_id NOT IN (?)", dryRuns(r.db)).
+		Order("id desc").Find(&reports).Error
+	return reports, err
+}
+
+// dryRuns selects the IDs of dry runs.
+func dryRuns(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.MigrationRun{}).Select("id").Where("dry_run = ?", true)
+}
+
+// migrateDraft stores migrated data and version on a draft, unless it was
+// edited, submitted or pinned since it was read.
+func migrateDraft(tx *gorm.DB, draft *models.Submission, data string, version int, userID uint) *gorm.DB {
+	return tx.Model(&models.Submission{}).
+		Where("id = ? AND status = ? AND version = ? AND pinned = ? AND updated_at = ?",
+			draft.ID, models.Draft, draft.Version, false, draft.UpdatedAt).
+		Updates(map[string]interface{}{"data": data, "version": version, "updated_by": userID})
+}
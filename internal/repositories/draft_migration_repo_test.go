@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test@tcp(127.0.0.1:1)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateDraftSkipsChangedDrafts(t *testing.T) {
+	readAt := time.Now()
+	draft := &models.Submission{Version: 2, Status: models.Draft}
+	draft.ID = 5
+	draft.UpdatedAt = readAt
+
+	stmt := migrateDraft(dryRunDB(t), draft, `{"a":1}`, 3, 9).Statement
+	sql := stmt.SQL.String()
+	if !strings.HasPrefix(sql, "UPDATE `submissions` SET ") {
+		t.Fatalf("unexpected statement %s", sql)
+	}
+	// The conditions are "col = ? AND ..." with their values last.
+	where := sql[strings.Index(sql, "WHERE (")+len("WHERE (") : strings.Index(sql, ") AND `submissions`.`deleted_at`")]
+	conds := strings.Split(where, " AND ")
+	vals := stmt.Vars[len(stmt.Vars)-len(conds):]
+	matches := func(row map[string]interface{}) bool {
+		for i, cond := range conds {
+			col := strings.TrimSuffix(cond, " = ?")
+			if !reflect.DeepEqual(row[col], vals[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(row map[string]interface{})
+		updated bool
+	}{
+		{"unchanged draft", func(row map[string]interface{}) {}, true},
+		{"edited since it was read", func(row map[string]interface{}) { row["updated_at"] = readAt.Add(time.Millisecond) }, false},
+		{"pinned since it was read", func(row map[string]interface{}) { row["pinned"] = true }, false},
+		{"submitted since it was read", func(row map[string]interface{}) { row["status"] = models.Submitted }, false},
+		{"migrated by another run", func(row map[string]interface{}) { row["version"] = 3 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := map[string]interface{}{"id": draft.ID, "status": models.Draft, "version": 2, "pinned": false, "updated_at": readAt}
+			tt.edit(row)
+			if got := matches(row); got != tt.updated {
+				t.Errorf("updated = %v, want %v (%s %v)", got, tt.updated, sql, stmt.Vars)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package repositories
 
 import (
+	"time"
+
 	"rcs-onboarding/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FormRepo struct {
@@ -18,14 +21,150 @@ func (r *FormRepo) Create(form *models.FormVersion) error {
 	return r.db.Create(form).Error
 }
 
-func (r *FormRepo) GetLatest(formType models.FormType) (*models.FormVersion, error) {
-	var template models.FormVersion
-	err := r.db.Where("type = ?", formType).Order("version desc").First(&template).Error
-	return &template, err
+func (r *FormRepo) Update(form *models.FormVersion) error {
+	return r.db.Save(form).Error
+}
+
+func (r *FormRepo) FindVersion(formType models.FormType, version int) (*models.FormVersion, error) {
+	var form models.FormVersion
+	err := r.db.Where("type = ? AND version = ?", formType, version).First(&form).Error
+	if err != nil {
+		return nil, err
+	}
+	return &form, nil
+}
+
+func (r *FormRepo) FindDraft(formType models.FormType) (*models.FormVersion, error) {
+	var form models.FormVersion
+	err := r.db.Where("type = ? AND status = ?", formType, models.FormVersionDraft).First(&form).Error
+	if err != nil {
+		return nil, err
+	}
+	return &form, nil
+}
+
+// Current returns the published version in effect at now: the one that took
+// effect most recently.
+func (r *FormRepo) Current(formType models.FormType, now time.Time) (*models.FormVersion, error) {
+	var form models.FormVersion
+	err := r.db.Where("type = ? AND status = ? AND effective_at <= ?", formType, models.FormVersionPublished, now).
+		Order("effective_at desc, version desc").First(&form).Error
+	if err != nil {
+		return nil, err
+	}
+	return &form, nil
+}
+
+// Publish stores a draft that has been marked published. It reports false,
+// storing nothing, when form.EffectiveAt is earlier than the effective time
+// of a version already published.
+func (r *FormRepo) Publish(form *models.FormVersion) (bool, error) {
+	return r.publish(form, func(tx *gorm.DB) error {
+		return tx.Save(form).Error
+	})
+}
+
+// CreateDraft stores form as a new draft numbered after the form's highest
+// version. It reports false, storing nothing, when the form already has a
+// draft.
+func (r *FormRepo) CreateDraft(form *models.FormVersion) (bool, error) {
+	created := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockFormType(tx, form.Type); err != nil {
+			return err
+		}
+		var drafts int64
+		err := tx.Model(&models.FormVersion{}).Where("type = ? AND status = ?", form.Type, models.FormVersionDraft).Count(&drafts).Error
+		if err != nil || drafts > 0 {
+			return err
+		}
+		if err := createNextVersion(tx, form); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created && err == nil, err
 }
 
-func (r *FormRepo) ListVersions(formType models.FormType) ([]models.FormVersion, error) {
+// CreatePublished stores a new version that is published from
+// form.EffectiveAt, numbered after the form's highest version, in one
+// transaction. It reports false, storing nothing, when form.EffectiveAt is
+// earlier than the effective time of a version already published.
+func (r *FormRepo) CreatePublished(form *models.FormVersion) (bool, error) {
+	return r.publish(form, func(tx *gorm.DB) error {
+		if err := lockFormType(tx, form.Type); err != nil {
+			return err
+		}
+		return createNextVersion(tx, form)
+	})
+}
+
+// lockFormType holds the form type's row until tx ends, so versions of the
+// type are numbered one at a time.
+func lockFormType(tx *gorm.DB, formType models.FormType) error {
+	var def models.FormTypeDefinition
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", formType).First(&def).Error
+}
+
+// createNextVersion stores form numbered after the form's highest version,
+// in any state. The caller holds the type's lock.
+func createNextVersion(tx *gorm.DB, form *models.FormVersion) error {
+	var max *int
+	err := tx.Model(&models.FormVersion{}).Where("type = ?", form.Type).Select("MAX(version)").Scan(&max).Error
+	if err != nil {
+		return err
+	}
+	form.Version = 1
+	if max != nil {
+		form.Version = *max + 1
+	}
+	return tx.Create(form).Error
+}
+
+// publish runs store once the form's published versions are locked and
+// form.EffectiveAt is known not to precede any of them, so versions take
+// effect in the order they were published.
+func (r *FormRepo) publish(form *models.FormVersion, store func(tx *gorm.DB) error) (bool, error) {
+	published := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var last []models.FormVersion
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("type = ? AND status IN ?", form.Type, []models.FormVersionStatus{models.FormVersionPublished, models.FormVersionDeprecated}).
+			Order("effective_at desc").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		if len(last) > 0 && last[0].EffectiveAt != nil && form.EffectiveAt.Before(*last[0].EffectiveAt) {
+			return nil
+		}
+		if err := store(tx); err != nil {
+			return err
+		}
+		published = true
+		return nil
+	})
+	return published && err == nil, err
+}
+
+func (r *FormRepo) ListVersions(formType models.FormType, includeDrafts bool) ([]models.FormVersion, error) {
 	var templates []models.FormVersion
-	err := r.db.Where("type = ?", formType).Order("version desc").Find(&templates).Error
+	q := r.db.Where("type = ?", formType)
+	if !includeDrafts {
+		q = q.Where("status <> ?", models.FormVersionDraft)
+	}
+	err := q.Order("version desc").Find(&templates).Error
 	return templates, err
 }
+
+// MigrationSteps returns the versions a draft on version after passes
+// through on its way to version upTo: every one published since, in order.
+// Versions retired after publishing stay in the chain, since later versions'
+// mappings expect the data in their shape; drafts withdrawn unpublished
+// never shaped any data and are left out.
+func (r *FormRepo) MigrationSteps(formType models.FormType, after int, upTo int) ([]*models.FormVersion, error) {
+	var steps []*models.FormVersion
+	err := r.db.Where("type = ? AND version > ? AND version <= ? AND published_at IS NOT NULL", formType, after, upTo).
+		Order("version asc").Find(&steps).Error
+	return steps, err
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type FormTypeRepo struct {
+	db *gorm.DB
+}
+
+func NewFormTypeRepo(db *gorm.DB) *FormTypeRepo {
+	return &FormTypeRepo{db: db}
+}
+
+func (r *FormTypeRepo) Create(formType *models.FormTypeDefinition) error {
+	return r.db.Create(formType).Error
+}
+
+func (r *FormTypeRepo) Update(formType *models.FormTypeDefinition) error {
+	return r.db.Save(formType).Error
+}
+
+func (r *FormTypeRepo) FindByKey(key models.FormType) (*models.FormTypeDefinition, error) {
+	var formType models.FormTypeDefinition
+	err := r.db.Where("`key` = ?", key).First(&formType).Error
+	if err != nil {
+		return nil, err
+	}
+	return &formType, nil
+}
+
+func (r *FormTypeRepo) List(enabledOnly bool) ([]models.FormTypeDefinition, error) {
+	var formTypes []models.FormTypeDefinition
+	q := r.db.Order("`key` asc")
+	if enabledOnly {
+		q = q.Where("enabled = ?", true)
+	}
+	err := q.Find(&formTypes).Error
+	return formTypes, err
+}
+
+func (r *FormTypeRepo) KeyExists(key models.FormType) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.FormTypeDefinition{}).Where("`key` = ?", key).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type InvitationRepo struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepo(db *gorm.DB) *InvitationRepo {
+	return &InvitationRepo{db: db}
+}
+
+func (r *InvitationRepo) Create(invite *models.Invitation) error {
+	return r.db.Create(invite).Error
+}
+
+func (r *InvitationRepo) FindByCodeHash(hash string) (*models.Invitation, error) {
+	var invite models.Invitation
+	err := r.db.Where("code_hash = ?", hash).First(&invite).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *InvitationRepo) List(pendingOnly bool, limit int, offset int) ([]models.Invitation, error) {
+	query := r.db.Order("id desc").Limit(limit).Offset(offset)
+	if pendingOnly {
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+	var invites []models.Invitation
+	err := query.Find(&invites).Error
+	return invites, err
+}
+
+// Accept claims a pending invitation and creates the account it invites in
+// one transaction, so a registration that fails leaves the invitation usable.
+// user.Password must already hold the hash, which seeds the password history.
+// It reports false when another registration got there first.
+func (r *InvitationRepo) Accept(id uint, user *models.User) (bool, error) {
+	accepted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id, now).
+			Update("accepted_at", now)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.PasswordHistory{UserID: user.ID, Hash: user.Password}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invitation{}).Where("id = ?", id).Update("accepted_user_id", user.ID).Error; err != nil {
+			return err
+		}
+		accepted = true
+		return nil
+	})
+	return accepted && err == nil, err
+}
+
+func (r *InvitationRepo) Revoke(id uint) (int64, error) {
+	res := r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// RevokePendingForEmail retires older codes so only the latest invite works.
+func (r *InvitationRepo) RevokePendingForEmail(email string) error {
+	return r.db.Model(&models.Invitation{}).
+		Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL", email).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginThrottleRepo struct {
+	db *gorm.DB
+}
+
+func NewLoginThrottleRepo(db *gorm.DB) *LoginThrottleRepo {
+	return &LoginThrottleRepo{db: db}
+}
+
+func (r *LoginThrottleRepo) Find(keys ...string) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	err := r.db.Where("throttle_key IN ?", keys).Find(&throttles).Error
+	return throttles, err
+}
+
+// AddFailure counts a failed attempt for key in one statement, creating
+// the row on first use and clearing a lock that has run out, so concurrent
+// failures are never lost. It returns the row as updated.
+func (r *LoginThrottleRepo) AddFailure(key string, now time.Time) (*models.LoginThrottle, error) {
+	throttle := models.LoginThrottle{ThrottleKey: key, Failures: 1, LastFailureAt: now}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "throttle_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("failures + 1"),
+			"last_failure_at": now,
+			"locked_until":    gorm.Expr("CASE WHEN locked_until <= ? THEN NULL ELSE locked_until END", now),
+			"updated_at":      now,
+		}),
+	}).Create(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Where("throttle_key = ?", key).First(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// LockIfReached locks key until the given time and restarts its count,
+// provided it has at least max failures. It reports whether this call
+// applied the lock, so a lockout is audited once.
+func (r *LoginThrottleRepo) LockIfReached(key string, max int, until time.Time) (bool, error) {
+	res := r.db.Model(&models.LoginThrottle{}).
+		Where("throttle_key = ? AND failures >= ?", key, max).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": until})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *LoginThrottleRepo) Delete(key string) error {
+	return r.db.Unscoped().Where("throttle_key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
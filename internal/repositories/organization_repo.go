@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type OrganizationRepo struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepo(db *gorm.DB) *OrganizationRepo {
+	return &OrganizationRepo{db: db}
+}
+
+func (r *OrganizationRepo) Create(org *models.Organization) error {
+	return r.db.Create(org).Error
+}
+
+func (r *OrganizationRepo) FindByID(id uint) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.First(&org, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *OrganizationRepo) List(limit int, offset int) ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := r.db.Order("name asc").Limit(limit).Offset(offset).Find(&orgs).Error
+	return orgs, err
+}
+
+func (r *OrganizationRepo) Members(orgID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("organization_id = ?", orgID).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+func (r *OrganizationRepo) SetMembership(userID uint, orgID *uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("organization_id", orgID).Error
+}
+
+func (r *OrganizationRepo) NameExists(name string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Organization{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
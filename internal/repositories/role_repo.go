@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepo struct {
+	db *gorm.DB
+}
+
+func NewRoleRepo(db *gorm.DB) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+func (r *RoleRepo) List() ([]models.RoleDefinition, error) {
+	var roles []models.RoleDefinition
+	err := r.db.Order("name asc").Find(&roles).Error
+	return roles, err
+}
+
+func (r *RoleRepo) FindByName(name models.Role) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	err := r.db.Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepo) Create(role *models.RoleDefinition, permissions []models.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(role).Error; err != nil {
+			return err
+		}
+		return replacePermissions(tx, role.Name, permissions)
+	})
+}
+
+func (r *RoleRepo) Delete(role *models.RoleDefinition) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(role).Error
+	})
+}
+
+func (r *RoleRepo) AllPermissions() ([]models.RolePermission, error) {
+	var grants []models.RolePermission
+	err := r.db.Find(&grants).Error
+	return grants, err
+}
+
+func (r *RoleRepo) SetPermissions(role models.Role, permissions []models.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replacePermissions(tx, role, permissions)
+	})
+}
+
+func (r *RoleRepo) CountUsers(role models.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+func replacePermissions(tx *gorm.DB, role models.Role, permissions []models.Permission) error {
+	if err := tx.Where("role = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	grants := make([]models.RolePermission, len(permissions))
+	for i, p := range permissions {
+		grants[i] = models.RolePermission{Role: role, Permission: p}
+	}
+	return tx.Create(&grants).Error
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionRepo(db *gorm.DB) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+func (r *SessionRepo) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *SessionRepo) FindByID(id uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepo) FindByRefreshHash(hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("refresh_token_hash = ?", hash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepo) FindByPreviousHash(hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("previous_token_hash = ?", hash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Rotate replaces a session's refresh token only if oldHash is still the
+// current one, so of two refreshes racing with the same token just one wins.
+func (r *SessionRepo) Rotate(id uint, oldHash string, newHash string, now time.Time) (bool, error) {
+	res := r.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{"refresh_token_hash": newHash, "previous_token_hash": oldHash, "last_seen_at": now})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *SessionRepo) Touch(id uint, at time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+// ClearMFAPending lifts the enrollment-only limit from a user's sessions.
+func (r *SessionRepo) ClearMFAPending(userID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND mfa_pending = ?", userID, true).
+		Update("mfa_pending", false).Error
+}
+
+func (r *SessionRepo) ListActiveForUser(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeForUser revokes one session only if it belongs to the user.
+func (r *SessionRepo) RevokeForUser(id uint, userID uint) (int64, error) {
+	res := r.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+func (r *SessionRepo) Revoke(id uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser also ends impersonation sessions the user started.
+func (r *SessionRepo) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("(user_id = ? OR impersonator_id = ?) AND revoked_at IS NULL", userID, userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *SessionRepo) RevokeOthersForUser(userID uint, keepID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// signingKeyRotationLock is the MySQL named lock that serializes key
+// rotation across instances.
+const signingKeyRotationLock = "rcs_onboarding.signing_key_rotation"
+
+type SigningKeyRepo struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepo(db *gorm.DB) *SigningKeyRepo {
+	return &SigningKeyRepo{db: db}
+}
+
+func (r *SigningKeyRepo) ListUnexpired(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Where("expires_at IS NULL OR expires_at > ?", now).Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+// UpdatePrivateKey replaces the stored private key of one row, e.g. to
+// encrypt a key written before encryption was configured.
+func (r *SigningKeyRepo) UpdatePrivateKey(id uint, privateKey string) error {
+	return r.db.Model(&models.SigningKey{}).Where("id = ?", id).Update("private_key", privateKey).Error
+}
+
+// Rotate stores next as the signing key and retires every other active key,
+// leaving them verifiable until expiresAt. Instances rotate one at a time
+// under a named lock, and only while the newest active key is still
+// currentKid (empty when there is none); otherwise another instance rotated
+// first and Rotate returns false without changing anything.
+func (r *SigningKeyRepo) Rotate(next *models.SigningKey, currentKid string, now time.Time, expiresAt time.Time) (bool, error) {
+	rotated := false
+	// The lock belongs to a connection, so hold one for the lock and the
+	// transaction and release it only after the commit.
+	err := r.db.Connection(func(conn *gorm.DB) error {
+		var acquired *int
+		if err := conn.Raw("SELECT GET_LOCK(?, 10)", signingKeyRotationLock).Scan(&acquired).Error; err != nil {
+			return err
+		}
+		if acquired == nil || *acquired != 1 {
+			return errors.New("timed out waiting for the signing key rotation lock")
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", signingKeyRotationLock)
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			var active models.SigningKey
+			err := tx.Where("retired_at IS NULL").Order("id desc").First(&active).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if currentKid != "" {
+					return nil
+				}
+			case err != nil:
+				return err
+			case active.Kid != currentKid:
+				return nil
+			}
+
+			err = tx.Model(&models.SigningKey{}).Where("retired_at IS NULL").
+				Updates(map[string]interface{}{"retired_at": now, "expires_at": expiresAt}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(next).Error; err != nil {
+				return err
+			}
+			rotated = true
+			return nil
+		})
+	})
+	return rotated, err
+}
@@ -29,10 +29,26 @@ func (r *SubmissionRepo) Update(sub *models.Submission) error {
 	return r.db.Save(sub).Error
 }
 
-func (r *SubmissionRepo) FindFiltered(userID uint, role models.Role, customerID *uint, status *string, startDate *time.Time, endDate *time.Time, limit int, offset int) ([]models.Submission, error) {
+// SaveAudited creates or updates a submission together with its audit
+// entry, so neither is stored without the other. A nil entry saves the
+// submission alone.
+func (r *SubmissionRepo) SaveAudited(sub *models.Submission, entry *models.AuditLog) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		entry.SubmissionID = sub.ID
+		return tx.Create(entry).Error
+	})
+}
+
+func (r *SubmissionRepo) FindFiltered(customerID *uint, organizationID *uint, status *string, startDate *time.Time, endDate *time.Time, limit int, offset int) ([]models.Submission, error) {
 	query := r.db.Limit(limit).Offset(offset)
-	if role != models.Admin {
-		query = query.Where("user_id = ?", userID)
+	if organizationID != nil {
+		query = query.Where("organization_id = ?", *organizationID)
 	}
 	if customerID != nil {
 		query = query.Where("user_id = ?", *customerID)
@@ -47,3 +63,12 @@ func (r *SubmissionRepo) FindFiltered(userID uint, role models.Role, customerID
 	err := query.Find(&subs).Error
 	return subs, err
 }
+
+// FindDraftsBehind returns up to limit drafts of a form type on a version
+// older than version, with IDs above afterID, in ID order.
+func (r *SubmissionRepo) FindDraftsBehind(formType models.FormType, version int, afterID uint, limit int) ([]models.Submission, error) {
+	var subs []models.Submission
+	err := r.db.Where("form_type = ? AND status = ? AND version < ? AND id > ?", formType, models.Draft, version, afterID).
+		Order("id asc").Limit(limit).Find(&subs).Error
+	return subs, err
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"time"
+
+	"rcs-onboarding/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type TokenRepo struct {
+	db *gorm.DB
+}
+
+func NewTokenRepo(db *gorm.DB) *TokenRepo {
+	return &TokenRepo{db: db}
+}
+
+func (r *TokenRepo) Create(token *models.OneTimeToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *TokenRepo) FindUsable(purpose models.TokenPurpose, hash string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := r.db.Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, time.Now()).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume marks a usable token as used and returns it. Of two concurrent
+// calls with the same token only one succeeds; the other gets
+// gorm.ErrRecordNotFound.
+func (r *TokenRepo) Consume(purpose models.TokenPurpose, hash string) (*models.OneTimeToken, error) {
+	token, err := r.FindUsable(purpose, hash)
+	if err != nil {
+		return nil, err
+	}
+	res := r.db.Model(&models.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return token, nil
+}
+
+// ConsumeAll marks every outstanding token of a purpose for the user as used,
+// so only one link can ever be redeemed.
+func (r *TokenRepo) ConsumeAll(userID uint, purpose models.TokenPurpose) error {
+	return r.db.Model(&models.OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
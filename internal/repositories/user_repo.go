@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"rcs-onboarding/internal/models"
 
 	"gorm.io/gorm"
@@ -22,3 +24,149 @@ func (r *UserRepo) FindByUsername(username string) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+func (r *UserRepo) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepo) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+// UpdateFields writes only the named columns of user, so changes made
+// elsewhere since it was loaded, such as a role change or a disable, are not
+// overwritten.
+func (r *UserRepo) UpdateFields(user *models.User, columns ...string) error {
+	return r.db.Model(user).Select(columns).Updates(user).Error
+}
+
+// AdvanceMFAStep records step as the user's last used TOTP step, unless that
+// step or a later one was already used. It reports whether it did, so two
+// requests with the same code cannot both pass.
+func (r *UserRepo) AdvanceMFAStep(userID uint, step int64) (bool, error) {
+	res := r.db.Model(&models.User{}).
+		Where("id = ? AND mfa_last_used_step < ?", userID, step).
+		Update("mfa_last_used_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *UserRepo) Delete(id uint) error {
+	return r.db.Delete(&models.User{}, id).Error
+}
+
+func (r *UserRepo) List(role *models.Role, limit int, offset int) ([]models.User, error) {
+	query := r.db.Order("id asc").Limit(limit).Offset(offset)
+	if role != nil {
+		query = query.Where("role = ?", *role)
+	}
+	var users []models.User
+	err := query.Find(&users).Error
+	return users, err
+}
+
+// ListProvisioned pages through users of an identity provider; empty filters
+// match everything.
+func (r *UserRepo) ListProvisioned(provider string, username string, externalID string, role *models.Role, limit int, offset int) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{}).Where("auth_provider = ?", provider)
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if externalID != "" {
+		query = query.Where("external_id = ?", externalID)
+	}
+	if role != nil {
+		query = query.Where("role = ?", *role)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	err := query.Order("id asc").Limit(limit).Offset(offset).Find(&users).Error
+	return users, total, err
+}
+
+func (r *UserRepo) UsernameExists(username string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+// FindOrCreateServiceAccount returns the disabled, passwordless account that
+// changes made by an integration are attributed to, creating it on first use.
+func (r *UserRepo) FindOrCreateServiceAccount(username string, provider string, role models.Role) (*models.User, error) {
+	var user models.User
+	err := r.db.Where(models.User{Username: username, AuthProvider: provider}).
+		Attrs(models.User{Role: role, Disabled: true}).
+		FirstOrCreate(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepo) EmailExists(email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *UserRepo) AddPasswordHistory(userID uint, hash string, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.PasswordHistory{UserID: userID, Hash: hash}).Error; err != nil {
+			return err
+		}
+		var ids []uint
+		err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+			Order("id desc").Pluck("id", &ids).Error
+		if err != nil || len(ids) <= keep {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.PasswordHistory{}, ids[keep:]).Error
+	})
+}
+
+func (r *UserRepo) RecentPasswordHashes(userID uint, limit int) ([]string, error) {
+	var hashes []string
+	err := r.db.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id desc").Limit(limit).Pluck("hash", &hashes).Error
+	return hashes, err
+}
+
+func (r *UserRepo) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		codes := make([]models.MFARecoveryCode, len(hashes))
+		for i, h := range hashes {
+			codes[i] = models.MFARecoveryCode{UserID: userID, CodeHash: h}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode atomically marks an unused code as used and reports whether it matched.
+func (r *UserRepo) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	res := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *UserRepo) FindByExternalID(provider string, externalID string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("auth_provider = ? AND external_id = ?", provider, externalID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
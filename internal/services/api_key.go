@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/utils"
+)
+
+const apiKeyPrefix = "rcs_"
+
+// APIKeyScopes lists the routes an API key may be scoped to. Account and
+// key management stay reserved for interactive sessions.
+var APIKeyScopes = []string{
+	"GET /api/v1/forms/:type/versions",
+	"GET /api/v1/forms/:type/versions/latest",
+	"POST /api/v1/submissions/:id",
+	"PUT /api/v1/submissions/:id",
+	"GET /api/v1/submissions",
+	"GET /api/v1/submissions/:id",
+}
+
+var (
+	ErrAPIKeyNotAllowed = errors.New("your role may not create API keys")
+	ErrInvalidScope     = errors.New("invalid API key scope")
+	ErrInvalidExpiry    = errors.New("invalid API key expiry")
+	ErrAPIKeyNotFound   = errors.New("API key not found")
+	ErrScopeDenied      = errors.New("API key is not scoped for this endpoint")
+)
+
+type CreatedAPIKey struct {
+	*models.APIKey
+	Key    string   `json:"key"` // Only returned once, at creation
+	Scopes []string `json:"scopes"`
+}
+
+func (s *AuthService) CreateAPIKey(userID uint, name string, scopes []string, expiresAt *time.Time) (*CreatedAPIKey, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.access.Can(user.Role, models.PermAPIKeyManage) {
+		return nil, ErrAPIKeyNotAllowed
+	}
+
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !containsString(APIKeyScopes, scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	now := time.Now()
+	if expiresAt == nil {
+		t := now.Add(s.cfg.APIKeyDefaultTTL)
+		expiresAt = &t
+	}
+	if !expiresAt.After(now) || expiresAt.Sub(now) > s.cfg.APIKeyMaxTTL {
+		return nil, ErrInvalidExpiry
+	}
+
+	prefix, err := utils.GenerateToken(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	// 6 random bytes encode to 8 characters; keep "_" out of the visible part.
+	prefix = apiKeyPrefix + strings.ReplaceAll(prefix, "_", "-")
+	raw := prefix + "_" + secret
+
+	key := &models.APIKey{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(raw),
+		Scopes:    strings.Join(scopes, "\n"),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, err
+	}
+	return &CreatedAPIKey{APIKey: key, Key: raw, Scopes: scopes}, nil
+}
+
+func (s *AuthService) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	return s.apiKeyRepo.ListByUser(userID)
+}
+
+func (s *AuthService) RevokeAPIKey(userID uint, id uint) error {
+	n, err := s.apiKeyRepo.Revoke(id, userID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ValidateAPIKey authenticates a raw key for the route identified by method
+// and gin route template, and returns the owning user.
+func (s *AuthService) ValidateAPIKey(raw string, method string, route string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, nil, ErrInvalidToken
+	}
+	// The secret part may itself contain "_", so split at the fixed prefix length.
+	sep := len(apiKeyPrefix) + 8
+	if len(raw) <= sep || raw[sep] != '_' {
+		return nil, nil, ErrInvalidToken
+	}
+	key, err := s.apiKeyRepo.FindByPrefix(raw[:sep])
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(raw)), []byte(key.KeyHash)) != 1 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, nil, ErrInvalidToken
+	}
+	user, err := s.repo.FindByID(key.UserID)
+	if err != nil || user.Disabled || !s.access.Can(user.Role, models.PermAPIKeyManage) {
+		return nil, nil, ErrInvalidToken
+	}
+	if !containsString(key.ScopeList(), method+" "+route) {
+		return nil, nil, ErrScopeDenied
+	}
+
+	// Only record usage once a minute to keep hot keys from writing on every request.
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		s.apiKeyRepo.TouchLastUsed(key.ID, now)
+	}
+	return key, user, nil
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -14,11 +14,25 @@ func NewAuditService(repo *repositories.AuditRepo) *AuditService {
 }
 
 func (s *AuditService) CreateAudit(submissionID uint, userID uint, action string, remarks string) error {
+	return s.Record(submissionID, userID, 0, action, remarks)
+}
+
+// Record writes an audit entry for actorID; onBehalfOfID is the impersonated
+// user when an admin acted through an impersonation token.
+func (s *AuditService) Record(submissionID uint, actorID uint, onBehalfOfID uint, action string, remarks string) error {
 	audit := &models.AuditLog{
 		SubmissionID: submissionID,
-		UserID:       userID,
+		UserID:       actorID,
+		OnBehalfOfID: onBehalfOfID,
 		Action:       action,
 		Remarks:      remarks,
 	}
 	return s.repo.Create(audit)
 }
+
+func (s *AuditService) List(submissionID *uint, userID *uint, limit int, offset int) ([]models.AuditLog, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.FindFiltered(submissionID, userID, limit, offset)
+}
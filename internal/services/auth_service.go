@@ -2,37 +2,480 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/models"
 	"rcs-onboarding/internal/repositories"
 	"rcs-onboarding/internal/utils"
 
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrAccountDisabled    = errors.New("account disabled")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrSelfAction         = errors.New("cannot perform this action on your own account")
+	ErrPasswordReused     = errors.New("password was used recently")
+)
+
+// dummyPasswordHash is checked against when a login names an unknown user.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("unknown-user-placeholder")
+	return hash
+})
+
+type Claims struct {
+	UserID    uint        `json:"user_id"`
+	Role      models.Role `json:"role"`
+	SessionID uint        `json:"sid"`
+	Purpose   string      `json:"purpose,omitempty"` // empty for access tokens
+	ActorID   uint        `json:"act,omitempty"`     // admin behind an impersonation token
+
+	// Read from the session on every request rather than signed into the
+	// token, so it lifts as soon as enrollment is confirmed.
+	MFAPending bool `json:"-"`
+	jwt.RegisteredClaims
+}
+
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type LoginResult struct {
+	*TokenPair
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	ChallengeToken        string   `json:"challenge_token,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`
+}
+
+// ClientInfo describes the device a session is started from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
 type AuthService struct {
-	repo *repositories.UserRepo
+	repo        *repositories.UserRepo
+	sessionRepo *repositories.SessionRepo
+	tokenRepo   *repositories.TokenRepo
+	policy      *PasswordPolicy
+	notifier    Notifier
+	guard       *LoginGuard
+	apiKeyRepo  *repositories.APIKeyRepo
+	keys        *KeyRing
+	oidc        *OIDCClient // nil when SSO is not configured
+	access      *PolicyService
+	cfg         *config.Config
 }
 
-func NewAuthService(repo *repositories.UserRepo) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo *repositories.UserRepo, sessionRepo *repositories.SessionRepo, tokenRepo *repositories.TokenRepo, policy *PasswordPolicy, notifier Notifier, guard *LoginGuard, apiKeyRepo *repositories.APIKeyRepo, keys *KeyRing, oidc *OIDCClient, access *PolicyService, cfg *config.Config) *AuthService {
+	return &AuthService{repo: repo, sessionRepo: sessionRepo, tokenRepo: tokenRepo, policy: policy, notifier: notifier, guard: guard, apiKeyRepo: apiKeyRepo, keys: keys, oidc: oidc, access: access, cfg: cfg}
 }
 
-func (s *AuthService) Login(username, password string) (string, error) {
+func (s *AuthService) Login(username, password string, client ClientInfo) (*LoginResult, error) {
+	ip := client.IP
+	if err := s.guard.Check(username, ip); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.FindByUsername(username)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		// Spend as long as a real check so timing does not reveal which
+		// usernames exist.
+		utils.CheckPasswordHash(password, dummyPasswordHash())
+		s.guard.RecordFailure(username, ip, 0)
+		return nil, ErrInvalidCredentials
 	}
 	if !utils.CheckPasswordHash(password, user.Password) {
-		return "", errors.New("invalid credentials")
+		s.guard.RecordFailure(username, ip, user.ID)
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if err := s.guard.RecordSuccess(username); err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		challenge, err := s.issueChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	// Users who must enroll get a session that can do nothing but enroll.
+	pending := s.mfaRequired(user.Role)
+	tokens, err := s.startSession(user, client, pending)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: tokens, MFAEnrollmentRequired: pending}, nil
+}
+
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	hash := utils.HashToken(refreshToken)
+	session, err := s.sessionRepo.FindByRefreshHash(hash)
+	if err != nil {
+		// A rotated-out token being replayed means it leaked; kill the whole session.
+		if reused, err := s.sessionRepo.FindByPreviousHash(hash); err == nil {
+			s.sessionRepo.Revoke(reused.ID)
+		}
+		return nil, ErrInvalidToken
+	}
+	if !session.Active(time.Now()) || session.ImpersonatorID != 0 {
+		return nil, ErrInvalidToken
 	}
 
-	cfg := config.LoadConfig()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+	user, err := s.repo.FindByID(session.UserID)
+	if err != nil || user.Disabled {
+		s.sessionRepo.Revoke(session.ID)
+		return nil, ErrInvalidToken
+	}
+
+	newRefresh, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.sessionRepo.Rotate(session.ID, hash, utils.HashToken(newRefresh), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another refresh used the same token first: treat it as reuse.
+		s.sessionRepo.Revoke(session.ID)
+		return nil, ErrInvalidToken
+	}
+
+	return s.issueTokens(user, session, newRefresh)
+}
+
+func (s *AuthService) Logout(sessionID uint) error {
+	return s.sessionRepo.Revoke(sessionID)
+}
+
+func (s *AuthService) ValidateToken(tokenStr string) (*Claims, error) {
+	claims, err := s.parseClaims(tokenStr)
+	if err != nil || claims.Purpose != "" {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := s.sessionRepo.FindByID(claims.SessionID)
+	now := time.Now()
+	if err != nil || !session.Active(now) || session.UserID != claims.UserID || session.ImpersonatorID != claims.ActorID {
+		return nil, ErrInvalidToken
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		s.sessionRepo.Touch(session.ID, now)
+	}
+	claims.MFAPending = session.MFAPending
+	return claims, nil
+}
+
+func (s *AuthService) JWKS() map[string]interface{} {
+	return s.keys.JWKS()
+}
+
+func (s *AuthService) parseClaims(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, s.keys.Keyfunc)
+	if err != nil || !token.Valid || !claims.VerifyIssuer(s.cfg.JWTIssuer, true) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *AuthService) startSession(user *models.User, client ClientInfo, mfaPending bool) (*TokenPair, error) {
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		ExpiresAt:        now.Add(s.cfg.RefreshTokenTTL),
+		UserAgent:        truncate(client.UserAgent, 255),
+		IP:               client.IP,
+		LastSeenAt:       now,
+		MFAPending:       mfaPending,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user, session, refreshToken)
+}
+
+func (s *AuthService) issueTokens(user *models.User, session *models.Session, refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	signed, err := s.keys.Sign(Claims{
+		UserID:    user.ID,
+		Role:      user.Role,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.JWTIssuer,
+			Subject:   fmt.Sprint(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
 	})
-	return token.SignedString(cfg.JWTKey)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		Token:        signed,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *AuthService) CreateUser(username, password string, role models.Role) (*models.User, error) {
+	return s.createUser(&models.User{Username: username, Role: role}, password)
+}
+
+// createUser validates and stores a local password account; callers may
+// pre-fill other fields such as the email or organization.
+func (s *AuthService) createUser(user *models.User, password string) (*models.User, error) {
+	if err := s.prepareUser(user, password); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(user); err != nil {
+		return nil, err
+	}
+	if err := s.repo.AddPasswordHistory(user.ID, user.Password, s.policy.HistorySize); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// prepareUser checks a new account and sets its password hash, leaving the
+// caller to store it.
+func (s *AuthService) prepareUser(user *models.User, password string) error {
+	user.Username = strings.TrimSpace(user.Username)
+	if user.Username == "" || password == "" {
+		return errors.New("username and password are required")
+	}
+	if !s.access.RoleExists(user.Role) {
+		return ErrInvalidRole
+	}
+	exists, err := s.repo.UsernameExists(user.Username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrUsernameTaken
+	}
+	if err := s.policy.Validate(password); err != nil {
+		return err
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
+func (s *AuthService) ListUsers(role *models.Role, limit int, offset int) ([]models.User, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.List(role, limit, offset)
+}
+
+func (s *AuthService) GetUser(id uint) (*models.User, error) {
+	user, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *AuthService) UpdateRole(actorID uint, id uint, role models.Role) (*models.User, error) {
+	if !s.access.RoleExists(role) {
+		return nil, ErrInvalidRole
+	}
+	if actorID == id {
+		return nil, ErrSelfAction
+	}
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = role
+	if err := s.repo.UpdateFields(user, "role"); err != nil {
+		return nil, err
+	}
+	// Outstanding tokens still carry the old role.
+	if err := s.sessionRepo.RevokeAllForUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthService) SetDisabled(actorID uint, id uint, disabled bool) (*models.User, error) {
+	if actorID == id {
+		return nil, ErrSelfAction
+	}
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	user.Disabled = disabled
+	if err := s.repo.UpdateFields(user, "disabled"); err != nil {
+		return nil, err
+	}
+	if disabled {
+		if err := s.sessionRepo.RevokeAllForUser(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *AuthService) DeleteUser(actorID uint, id uint) error {
+	if actorID == id {
+		return ErrSelfAction
+	}
+	if _, err := s.GetUser(id); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAllForUser(id); err != nil {
+		return err
+	}
+	if err := s.apiKeyRepo.RevokeAllForUser(id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+func (s *AuthService) Unlock(id uint) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	return s.guard.Unlock(user.Username)
+}
+
+func (s *AuthService) ChangePassword(userID uint, sessionID uint, current string, newPassword string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(current, user.Password) {
+		return ErrInvalidCredentials
+	}
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeOthersForUser(user.ID, sessionID)
+}
+
+func (s *AuthService) RequestPasswordReset(id uint) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.ConsumeAll(user.ID, models.PasswordResetToken); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.tokenRepo.Create(&models.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   models.PasswordResetToken,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("An administrator started a password reset for your account. Use this token within %s to choose a new password: %s", s.cfg.PasswordResetTTL, token)
+	return s.notifier.Notify(user, "Password reset", body)
+}
+
+// ResetPassword checks the new password before redeeming the token, so a
+// rejected password does not use the token up. The token is then consumed
+// atomically before the password changes, which keeps it single-use even
+// under concurrent requests.
+func (s *AuthService) ResetPassword(token string, newPassword string) error {
+	hash := utils.HashToken(token)
+	resetToken, err := s.tokenRepo.FindUsable(models.PasswordResetToken, hash)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	user, err := s.GetUser(resetToken.UserID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := s.checkNewPassword(user, newPassword); err != nil {
+		return err
+	}
+	if _, err := s.tokenRepo.Consume(models.PasswordResetToken, hash); err != nil {
+		return ErrInvalidToken
+	}
+	if err := s.storePassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.ConsumeAll(user.ID, models.PasswordResetToken); err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeAllForUser(user.ID)
+}
+
+func (s *AuthService) setPassword(user *models.User, password string) error {
+	if err := s.checkNewPassword(user, password); err != nil {
+		return err
+	}
+	return s.storePassword(user, password)
+}
+
+// checkNewPassword applies the policy and the reuse history.
+func (s *AuthService) checkNewPassword(user *models.User, password string) error {
+	if err := s.policy.Validate(password); err != nil {
+		return err
+	}
+	if utils.CheckPasswordHash(password, user.Password) {
+		return ErrPasswordReused
+	}
+	history, err := s.repo.RecentPasswordHashes(user.ID, s.policy.HistorySize)
+	if err != nil {
+		return err
+	}
+	for _, old := range history {
+		if utils.CheckPasswordHash(password, old) {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+func (s *AuthService) storePassword(user *models.User, password string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	if err := s.repo.UpdateFields(user, "password"); err != nil {
+		return err
+	}
+	return s.repo.AddPasswordHistory(user.ID, hash, s.policy.HistorySize)
 }
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+	"rcs-onboarding/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotCurrentVersion    = errors.New("drafts can only be migrated to the current version")
+	ErrMigrationRunNotFound = errors.New("migration run not found")
+)
+
+// migrationBatchSize is how many drafts are loaded at a time; the run's
+// counts are saved after each batch.
+const migrationBatchSize = 100
+
+type DraftMigrationService struct {
+	repo     *repositories.DraftMigrationRepo
+	subRepo  *repositories.SubmissionRepo
+	formRepo *repositories.FormRepo
+	forms    *FormService
+	subs     *SubmissionService
+}
+
+func NewDraftMigrationService(repo *repositories.DraftMigrationRepo, subRepo *repositories.SubmissionRepo, formRepo *repositories.FormRepo, forms *FormService, subs *SubmissionService) *DraftMigrationService {
+	return &DraftMigrationService{repo: repo, subRepo: subRepo, formRepo: formRepo, forms: forms, subs: subs}
+}
+
+// StartMigration starts a run that moves every unpinned draft on an older
+// version of a form to version, which must be current, applying the field
+// mappings of each version in between. Drafts whose migrated data is
+// invalid keep their data and version; each attempt is reported. A dry run
+// only stores its reports. The run continues in the background; follow it
+// with GetRun and Reports.
+func (s *DraftMigrationService) StartMigration(formType models.FormType, version int, userID uint, dryRun bool) (*models.MigrationRun, error) {
+	target, err := s.forms.GetVersion(formType, version)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.forms.GetCurrent(formType)
+	if err != nil {
+		return nil, err
+	}
+	if current.ID != target.ID {
+		return nil, ErrNotCurrentVersion
+	}
+
+	run := &models.MigrationRun{
+		FormType: formType,
+		Version:  version,
+		DryRun:   dryRun,
+		Status:   models.MigrationRunRunning,
+		RunBy:    userID,
+	}
+	if err := s.repo.CreateRun(run); err != nil {
+		return nil, err
+	}
+	job := *run
+	go s.run(&job)
+	return run, nil
+}
+
+// run migrates a run's drafts and records how it ended.
+func (s *DraftMigrationService) run(run *models.MigrationRun) {
+	err := s.migrateDrafts(run)
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.MigrationRunCompleted
+	if err != nil {
+		log.Error().Err(err).Uint("run_id", run.ID).Msg("Draft migration failed")
+		run.Status = models.MigrationRunFailed
+		run.Error = err.Error()
+	}
+	if err := s.repo.UpdateRun(run); err != nil {
+		log.Error().Err(err).Uint("run_id", run.ID).Msg("Failed to save draft migration run")
+	}
+}
+
+func (s *DraftMigrationService) migrateDrafts(run *models.MigrationRun) error {
+	steps := map[int][]*models.FormVersion{}
+	var afterID uint
+	for {
+		drafts, err := s.subRepo.FindDraftsBehind(run.FormType, run.Version, afterID, migrationBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range drafts {
+			sub := &drafts[i]
+			afterID = sub.ID
+			if sub.Pinned {
+				run.Pinned++
+				continue
+			}
+			if _, ok := steps[sub.Version]; !ok {
+				if steps[sub.Version], err = s.formRepo.MigrationSteps(run.FormType, sub.Version, run.Version); err != nil {
+					return err
+				}
+			}
+			status, err := s.migrate(run, sub, steps[sub.Version])
+			if err != nil {
+				return err
+			}
+			switch status {
+			case models.MigrationMigrated:
+				run.Migrated++
+			case models.MigrationFailed:
+				run.Failed++
+			}
+		}
+		if err := s.repo.UpdateRun(run); err != nil {
+			return err
+		}
+		if len(drafts) < migrationBatchSize {
+			return nil
+		}
+	}
+}
+
+// migrate moves one draft and stores its report, returning the outcome. It
+// returns "" when the draft changed while it was being migrated, so it was
+// left alone.
+func (s *DraftMigrationService) migrate(run *models.MigrationRun, sub *models.Submission, steps []*models.FormVersion) (string, error) {
+	report := &models.DraftMigration{
+		RunID:        run.ID,
+		SubmissionID: sub.ID,
+		FormType:     sub.FormType,
+		FromVersion:  sub.Version,
+		ToVersion:    run.Version,
+		Status:       models.MigrationMigrated,
+		RunBy:        run.RunBy,
+	}
+
+	data, changes, err := utils.MigrateData(steps, sub.Data)
+	var invalid *utils.ValidationError
+	if errors.As(err, &invalid) {
+		report.Status = models.MigrationFailed
+		errorsJSON, _ := json.Marshal(invalid.Errors)
+		report.Errors = string(errorsJSON)
+	} else if err != nil {
+		return "", err
+	}
+	changesJSON, _ := json.Marshal(changes)
+	report.Changes = string(changesJSON)
+
+	switch {
+	case run.DryRun:
+		err = s.repo.Create(report)
+	case report.Status == models.MigrationFailed:
+		err = s.repo.RecordFailure(report)
+	default:
+		audit := &models.AuditLog{
+			SubmissionID: sub.ID,
+			UserID:       run.RunBy,
+			Action:       "Migrated Draft",
+			Remarks:      fmt.Sprintf("Version %d to %d", sub.Version, run.Version),
+		}
+		migrated, err := s.repo.Migrate(sub, data, report, audit)
+		if err != nil || !migrated {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return report.Status, nil
+}
+
+// GetRun returns a migration run of a form.
+func (s *DraftMigrationService) GetRun(formType models.FormType, id uint) (*models.MigrationRun, error) {
+	run, err := s.repo.FindRun(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && run.FormType != formType) {
+		return nil, ErrMigrationRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Reports pages through the reports of a migration run.
+func (s *DraftMigrationService) Reports(formType models.FormType, id uint, limit int, offset int) ([]models.DraftMigration, error) {
+	if _, err := s.GetRun(formType, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.FindReports(id, limit, offset)
+}
+
+// ForSubmission lists the migration reports of a submission the caller can
+// see.
+func (s *DraftMigrationService) ForSubmission(id uint, userID uint, role models.Role) ([]models.DraftMigration, error) {
+	if _, err := s.subs.GetByID(id, userID, role); err != nil {
+		return nil, err
+	}
+	return s.repo.FindBySubmission(id)
+}
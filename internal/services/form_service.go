@@ -3,52 +3,359 @@ package services
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
+
 	"rcs-onboarding/internal/models"
 	"rcs-onboarding/internal/repositories"
+	"rcs-onboarding/internal/utils"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidSchema       = errors.New("invalid schema")
+	ErrFormVersionNotFound = errors.New("form version not found")
+	ErrNoPublishedVersion  = errors.New("this form has no published version")
+	ErrDraftExists         = errors.New("this form already has a draft version; edit or retire it first")
+	ErrNotDraft            = errors.New("only draft versions can be edited or published")
+	ErrVersionInUse        = errors.New("the current version cannot be retired until another takes effect")
+	ErrVersionRetired      = errors.New("version is already retired")
+	ErrEffectiveTooEarly   = errors.New("effective_at must not be before that of an already published version")
+)
+
+// FormDefinition is the editable content of a form version.
+type FormDefinition struct {
+	Schema        []models.Field `json:"schema" binding:"required"`
+	Rules         []models.Rule  `json:"rules"`
+	UnknownFields string         `json:"unknown_fields"` // keep (default), strip or reject
+
+	// How drafts of the previous version are moved to this one.
+	Mappings []models.FieldMapping `json:"mappings"`
+}
+
 type FormService struct {
-	repo *repositories.FormRepo
+	repo      *repositories.FormRepo
+	formTypes *FormTypeService
 }
 
-func NewFormService(repo *repositories.FormRepo) *FormService {
-	return &FormService{repo: repo}
+func NewFormService(repo *repositories.FormRepo, formTypes *FormTypeService) *FormService {
+	return &FormService{repo: repo, formTypes: formTypes}
 }
 
-func (s *FormService) Create(formType models.FormType, schema []models.Field) (*models.FormVersion, error) {
-	// Compute next version
-	latest, err := s.repo.GetLatest(formType)
-	nextVersion := 1
+// apply lints a definition and stores it on a version.
+func (s *FormService) apply(form *models.FormVersion, def FormDefinition) error {
+	if err := utils.CheckSchema(def.Schema, def.Rules, def.UnknownFields, def.Mappings); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	if def.UnknownFields == "" {
+		def.UnknownFields = models.UnknownFieldsKeep
+	}
+	if def.Rules == nil {
+		def.Rules = []models.Rule{}
+	}
+	if def.Mappings == nil {
+		def.Mappings = []models.FieldMapping{}
+	}
+	schemaJSON, err := json.Marshal(def.Schema)
+	if err != nil {
+		return err
+	}
+	rulesJSON, err := json.Marshal(def.Rules)
+	if err != nil {
+		return err
+	}
+	mappingsJSON, err := json.Marshal(def.Mappings)
+	if err != nil {
+		return err
+	}
+	form.Schema = string(schemaJSON)
+	form.Rules = string(rulesJSON)
+	form.Mappings = string(mappingsJSON)
+	form.UnknownFields = def.UnknownFields
+	return nil
+}
+
+// Create stores the next version of a form as a draft. Submissions are not
+// affected until it is published; a form has at most one draft at a time.
+func (s *FormService) Create(formType models.FormType, def FormDefinition) (*models.FormVersion, error) {
+	newForm, err := s.newVersion(formType, def)
+	if err != nil {
+		return nil, err
+	}
+	newForm.Status = models.FormVersionDraft
+	created, err := s.repo.CreateDraft(newForm)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrDraftExists
+	}
+	return newForm, nil
+}
+
+// CreatePublished stores the next version of a form and publishes it from
+// effectiveAt, as Create followed by Publish would, but in one transaction:
+// when publishing is refused no draft is left behind.
+func (s *FormService) CreatePublished(formType models.FormType, def FormDefinition, effectiveAt *time.Time) (*models.FormVersion, error) {
+	newForm, err := s.newVersion(formType, def)
+	if err != nil {
+		return nil, err
+	}
+	markPublished(newForm, effectiveAt)
+	published, err := s.repo.CreatePublished(newForm)
+	if err != nil {
+		return nil, err
+	}
+	if !published {
+		return nil, ErrEffectiveTooEarly
+	}
+	return newForm, nil
+}
+
+// newVersion checks that a form can take a new version and builds it from
+// def.
+func (s *FormService) newVersion(formType models.FormType, def FormDefinition) (*models.FormVersion, error) {
+	if _, err := s.formTypes.Get(formType); err != nil {
+		return nil, err
+	}
+	_, err := s.repo.FindDraft(formType)
 	if err == nil {
-		nextVersion = latest.Version + 1
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDraftExists
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	form := &models.FormVersion{Type: formType}
+	if err := s.apply(form, def); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// markPublished publishes a version from effectiveAt, or from now when that
+// is nil or in the past.
+func markPublished(form *models.FormVersion, effectiveAt *time.Time) {
+	now := time.Now()
+	effective := now
+	if effectiveAt != nil && effectiveAt.After(now) {
+		effective = *effectiveAt
+	}
+	form.Status = models.FormVersionPublished
+	form.EffectiveAt = &effective
+	form.PublishedAt = &now
+}
+
+// UpdateDraft replaces the definition of a draft version.
+func (s *FormService) UpdateDraft(formType models.FormType, version int, def FormDefinition) (*models.FormVersion, error) {
+	form, err := s.findVersion(formType, version)
+	if err != nil {
+		return nil, err
+	}
+	if form.Status != models.FormVersionDraft {
+		return nil, ErrNotDraft
+	}
+	if err := s.apply(form, def); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(form); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// Publish makes a draft the form's version from effectiveAt on (now when nil
+// or in the past). Until then the previous version stays current, and
+// published versions cannot be scheduled out of order.
+func (s *FormService) Publish(formType models.FormType, version int, effectiveAt *time.Time) (*models.FormVersion, error) {
+	form, err := s.findVersion(formType, version)
+	if err != nil {
+		return nil, err
+	}
+	if form.Status != models.FormVersionDraft {
+		return nil, ErrNotDraft
+	}
+	// Drafts are linted on save, but formats or generators may have changed
+	// since.
+	fields, err := form.Fields()
+	if err != nil {
 		return nil, err
 	}
+	rules, err := form.DecodeRules()
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := form.DecodeMappings()
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckSchema(fields, rules, form.UnknownFields, mappings); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
 
-	schemaJSON, err := json.Marshal(schema)
+	markPublished(form, effectiveAt)
+	published, err := s.repo.Publish(form)
 	if err != nil {
 		return nil, err
 	}
+	if !published {
+		return nil, ErrEffectiveTooEarly
+	}
+	return form, nil
+}
 
-	newForm := &models.FormVersion{
-		Type:    formType,
-		Version: nextVersion,
-		Schema:  string(schemaJSON),
+// Retire withdraws a version. The version in effect cannot be retired, so a
+// form never loses its current version.
+func (s *FormService) Retire(formType models.FormType, version int) (*models.FormVersion, error) {
+	form, err := s.findVersion(formType, version)
+	if err != nil {
+		return nil, err
+	}
+	if form.Status == models.FormVersionRetired {
+		return nil, ErrVersionRetired
+	}
+	current, err := s.repo.Current(formType, time.Now())
+	if err == nil && current.ID == form.ID {
+		return nil, ErrVersionInUse
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
 	}
 
-	if err := s.repo.Create(newForm); err != nil {
+	form.Status = models.FormVersionRetired
+	if err := s.repo.Update(form); err != nil {
 		return nil, err
 	}
+	return form, nil
+}
 
-	return newForm, nil
+// DryRunResult is the outcome of checking a form definition without
+// publishing it.
+type DryRunResult struct {
+	Valid    bool                  `json:"valid"`
+	Problems []utils.SchemaProblem `json:"problems"`
+
+	// Set when sample data was given and the definition is valid.
+	Data   json.RawMessage    `json:"data,omitempty"`
+	Errors []utils.FieldError `json:"errors,omitempty"`
 }
 
-func (s *FormService) GetLatest(formType models.FormType) (*models.FormVersion, error) {
-	return s.repo.GetLatest(formType)
+// DryRun lints a form definition, and when it is valid and sample data is
+// given, validates the data as a submission to it would be.
+func (s *FormService) DryRun(formType models.FormType, def FormDefinition, sample string) (*DryRunResult, error) {
+	if _, err := s.formTypes.Get(formType); err != nil {
+		return nil, err
+	}
+	result := &DryRunResult{Valid: true, Problems: utils.LintSchema(def.Schema, def.Rules, def.UnknownFields, def.Mappings)}
+	for _, p := range result.Problems {
+		if p.Severity == utils.SeverityError {
+			result.Valid = false
+		}
+	}
+	if !result.Valid || sample == "" {
+		return result, nil
+	}
+
+	form := &models.FormVersion{Type: formType}
+	if err := s.apply(form, def); err != nil {
+		return nil, err
+	}
+	data, err := utils.ValidateData(form, sample)
+	var invalid *utils.ValidationError
+	if errors.As(err, &invalid) {
+		result.Errors = invalid.Errors
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Data = json.RawMessage(data)
+	return result, nil
 }
 
-func (s *FormService) ListVersions(formType models.FormType) ([]models.FormVersion, error) {
-	return s.repo.ListVersions(formType)
+// GetCurrent returns the version submissions bind to now.
+func (s *FormService) GetCurrent(formType models.FormType) (*models.FormVersion, error) {
+	current, err := s.repo.Current(formType, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoPublishedVersion
+	}
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// GetVersion returns a version with its status as of now.
+func (s *FormService) GetVersion(formType models.FormType, version int) (*models.FormVersion, error) {
+	form, err := s.findVersion(formType, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withStatus(formType, form); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// findVersion returns a version with its stored status, for changing it.
+func (s *FormService) findVersion(formType models.FormType, version int) (*models.FormVersion, error) {
+	form, err := s.repo.FindVersion(formType, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFormVersionNotFound
+	}
+	return form, err
+}
+
+// withStatus reports published versions that a later version has
+// superseded as deprecated. Deprecation is worked out when versions are
+// read rather than stored, so it shows the moment the newer version's
+// effective_at passes and reading never writes.
+func (s *FormService) withStatus(formType models.FormType, forms ...*models.FormVersion) error {
+	current, err := s.repo.Current(formType, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, form := range forms {
+		if form.Status != models.FormVersionPublished || form.ID == current.ID || form.EffectiveAt == nil {
+			continue
+		}
+		if form.EffectiveAt.Before(*current.EffectiveAt) ||
+			(form.EffectiveAt.Equal(*current.EffectiveAt) && form.Version < current.Version) {
+			form.Status = models.FormVersionDeprecated
+		}
+	}
+	return nil
+}
+
+// Diff compares version from with version to of a form.
+func (s *FormService) Diff(formType models.FormType, from int, to int) (*utils.SchemaDiff, error) {
+	a, err := s.GetVersion(formType, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.GetVersion(formType, to)
+	if err != nil {
+		return nil, err
+	}
+	return utils.DiffVersions(a, b)
+}
+
+// ListVersions lists a form's versions, newest first, with their status as
+// of now.
+func (s *FormService) ListVersions(formType models.FormType, includeDrafts bool) ([]models.FormVersion, error) {
+	versions, err := s.repo.ListVersions(formType, includeDrafts)
+	if err != nil {
+		return nil, err
+	}
+	forms := make([]*models.FormVersion, len(versions))
+	for i := range versions {
+		forms[i] = &versions[i]
+	}
+	if err := s.withStatus(formType, forms...); err != nil {
+		return nil, err
+	}
+	return versions, nil
 }
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+var formTypeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+var (
+	ErrFormTypeNotFound   = errors.New("form type not found")
+	ErrFormTypeExists     = errors.New("form type already exists")
+	ErrFormTypeDisabled   = errors.New("form type is not accepting submissions")
+	ErrFormTypeNotAllowed = errors.New("your role cannot use this form type")
+	ErrInvalidFormTypeKey = errors.New("form type key must be 2-64 lowercase letters, digits or underscores, starting with a letter")
+)
+
+// FormTypeInput is what an admin sets on a form type. Nil fields are left
+// unchanged by Update.
+type FormTypeInput struct {
+	DisplayName    *string        `json:"display_name"`
+	Description    *string        `json:"description"`
+	SubmitterRoles *[]models.Role `json:"submitter_roles"`
+	ReviewerRoles  *[]models.Role `json:"reviewer_roles"`
+	Enabled        *bool          `json:"enabled"`
+}
+
+type FormTypeView struct {
+	*models.FormTypeDefinition
+	SubmitterRoles []models.Role `json:"submitter_roles"`
+	ReviewerRoles  []models.Role `json:"reviewer_roles"`
+}
+
+func newFormTypeView(t *models.FormTypeDefinition) *FormTypeView {
+	return &FormTypeView{FormTypeDefinition: t, SubmitterRoles: t.Submitters(), ReviewerRoles: t.Reviewers()}
+}
+
+// FormTypeService is the registry of form types. Which types exist, who may
+// submit and review them, and whether they are open are data, editable by
+// admins.
+type FormTypeService struct {
+	repo   *repositories.FormTypeRepo
+	access *PolicyService
+}
+
+func NewFormTypeService(repo *repositories.FormTypeRepo, access *PolicyService) *FormTypeService {
+	return &FormTypeService{repo: repo, access: access}
+}
+
+func (s *FormTypeService) Create(key models.FormType, in FormTypeInput) (*FormTypeView, error) {
+	if !formTypeKeyPattern.MatchString(string(key)) {
+		return nil, ErrInvalidFormTypeKey
+	}
+	exists, err := s.repo.KeyExists(key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrFormTypeExists
+	}
+	formType := &models.FormTypeDefinition{Key: key, DisplayName: string(key), Enabled: true}
+	if err := s.apply(formType, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(formType); err != nil {
+		return nil, err
+	}
+	return newFormTypeView(formType), nil
+}
+
+func (s *FormTypeService) Update(key models.FormType, in FormTypeInput) (*FormTypeView, error) {
+	formType, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(formType, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(formType); err != nil {
+		return nil, err
+	}
+	return newFormTypeView(formType), nil
+}
+
+func (s *FormTypeService) apply(formType *models.FormTypeDefinition, in FormTypeInput) error {
+	if in.DisplayName != nil {
+		name := strings.TrimSpace(*in.DisplayName)
+		if name == "" {
+			return errors.New("display_name must not be empty")
+		}
+		formType.DisplayName = name
+	}
+	if in.Description != nil {
+		formType.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.SubmitterRoles != nil {
+		if err := s.checkRoles(*in.SubmitterRoles); err != nil {
+			return err
+		}
+		formType.SubmitterRoles = models.JoinRoles(*in.SubmitterRoles)
+	}
+	if in.ReviewerRoles != nil {
+		if err := s.checkRoles(*in.ReviewerRoles); err != nil {
+			return err
+		}
+		formType.ReviewerRoles = models.JoinRoles(*in.ReviewerRoles)
+	}
+	if in.Enabled != nil {
+		formType.Enabled = *in.Enabled
+	}
+	return nil
+}
+
+func (s *FormTypeService) checkRoles(roles []models.Role) error {
+	for _, role := range roles {
+		if !s.access.RoleExists(role) {
+			return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+		}
+	}
+	return nil
+}
+
+func (s *FormTypeService) Get(key models.FormType) (*models.FormTypeDefinition, error) {
+	formType, err := s.repo.FindByKey(key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFormTypeNotFound
+	}
+	return formType, err
+}
+
+func (s *FormTypeService) View(key models.FormType) (*FormTypeView, error) {
+	formType, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return newFormTypeView(formType), nil
+}
+
+func (s *FormTypeService) List(enabledOnly bool) ([]*FormTypeView, error) {
+	formTypes, err := s.repo.List(enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]*FormTypeView, len(formTypes))
+	for i := range formTypes {
+		views[i] = newFormTypeView(&formTypes[i])
+	}
+	return views, nil
+}
+
+// ForSubmission returns a form type that role may submit now.
+func (s *FormTypeService) ForSubmission(key models.FormType, role models.Role) (*models.FormTypeDefinition, error) {
+	formType, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !formType.Enabled {
+		return nil, ErrFormTypeDisabled
+	}
+	if !formType.AllowsSubmitter(role) {
+		return nil, ErrFormTypeNotAllowed
+	}
+	return formType, nil
+}
+
+// CheckReviewer reports whether role may review submissions of the type.
+// Reviews continue after a type is disabled.
+func (s *FormTypeService) CheckReviewer(key models.FormType, role models.Role) error {
+	formType, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if !formType.AllowsReviewer(role) {
+		return ErrFormTypeNotAllowed
+	}
+	return nil
+}
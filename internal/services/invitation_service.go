@@ -0,0 +1,210 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+	"rcs-onboarding/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidEmail         = errors.New("invalid email address")
+	ErrEmailTaken           = errors.New("an account with this email already exists")
+	ErrInvitationInvalid    = errors.New("invitation is invalid, used or expired")
+	ErrInvitationNotFound   = errors.New("invitation not found or no longer pending")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+type InvitationService struct {
+	repo      *repositories.InvitationRepo
+	orgRepo   *repositories.OrganizationRepo
+	userRepo  *repositories.UserRepo
+	tokenRepo *repositories.TokenRepo
+	auth      *AuthService
+	mailer    Mailer
+	cfg       *config.Config
+}
+
+func NewInvitationService(repo *repositories.InvitationRepo, orgRepo *repositories.OrganizationRepo, userRepo *repositories.UserRepo, tokenRepo *repositories.TokenRepo, auth *AuthService, mailer Mailer, cfg *config.Config) *InvitationService {
+	return &InvitationService{repo: repo, orgRepo: orgRepo, userRepo: userRepo, tokenRepo: tokenRepo, auth: auth, mailer: mailer, cfg: cfg}
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// Create invites email to register for an organization. The code is only
+// ever emailed to the invitee, never returned to the inviter.
+func (s *InvitationService) Create(inviterID uint, email string, organizationID uint) (*models.Invitation, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.orgRepo.FindByID(organizationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	taken, err := s.userRepo.EmailExists(email)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+	if err := s.repo.RevokePendingForEmail(email); err != nil {
+		return nil, err
+	}
+
+	code, err := utils.GenerateToken(24)
+	if err != nil {
+		return nil, err
+	}
+	invite := &models.Invitation{
+		Email:          email,
+		OrganizationID: org.ID,
+		CodeHash:       utils.HashToken(code),
+		InvitedBy:      inviterID,
+		ExpiresAt:      time.Now().Add(s.cfg.InvitationTTL),
+	}
+	if err := s.repo.Create(invite); err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf("You have been invited to onboard with %s.\n\nRegister within %s at %s/api/v1/auth/register using this invitation code:\n\n%s\n",
+		org.Name, s.cfg.InvitationTTL, s.cfg.AppBaseURL, code)
+	if err := s.mailer.Send(email, "Your RCS onboarding invitation", body); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (s *InvitationService) List(pendingOnly bool, limit int, offset int) ([]models.Invitation, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.List(pendingOnly, limit, offset)
+}
+
+func (s *InvitationService) Revoke(id uint) error {
+	rows, err := s.repo.Revoke(id)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// Register creates a customer account from an invitation code. The account
+// can log in straight away but cannot submit until its email is verified;
+// if the verification email cannot be sent, it can be resent later.
+func (s *InvitationService) Register(code string, username string, password string) (*models.User, error) {
+	invite, err := s.repo.FindByCodeHash(utils.HashToken(code))
+	if err != nil || !invite.Pending(time.Now()) {
+		return nil, ErrInvitationInvalid
+	}
+	taken, err := s.userRepo.EmailExists(invite.Email)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+
+	orgID := invite.OrganizationID
+	user := &models.User{
+		Username:       username,
+		Role:           models.Customer,
+		OrganizationID: &orgID,
+		Email:          invite.Email,
+	}
+	if err := s.auth.prepareUser(user, password); err != nil {
+		return nil, err
+	}
+	accepted, err := s.repo.Accept(invite.ID, user)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, ErrInvitationInvalid
+	}
+	// The account and invitation are committed, so a failed email must not
+	// fail the registration; the user can ask for it again.
+	if err := s.sendVerification(user); err != nil {
+		log.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to send verification email")
+	}
+	return user, nil
+}
+
+func (s *InvitationService) ResendVerification(userID uint) error {
+	user, err := s.auth.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerification(user)
+}
+
+func (s *InvitationService) sendVerification(user *models.User) error {
+	if err := s.tokenRepo.ConsumeAll(user.ID, models.EmailVerificationToken); err != nil {
+		return err
+	}
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.tokenRepo.Create(&models.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   models.EmailVerificationToken,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your email address within %s by opening this link:\n\n%s/api/v1/auth/verify-email?token=%s\n",
+		user.Username, s.cfg.EmailVerificationTTL, s.cfg.AppBaseURL, token)
+	return s.mailer.Send(user.Email, "Verify your email address", body)
+}
+
+func (s *InvitationService) VerifyEmail(token string) (*models.User, error) {
+	verification, err := s.tokenRepo.FindUsable(models.EmailVerificationToken, utils.HashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.auth.GetUser(verification.UserID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := s.tokenRepo.ConsumeAll(user.ID, models.EmailVerificationToken); err != nil {
+		return nil, err
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.UpdateFields(user, "email_verified_at"); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+	"rcs-onboarding/internal/utils"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Unknown kids trigger a reload so keys rotated by another instance are
+// picked up, but no more often than this. Signing reloads on the same
+// schedule, so a key another instance retired stops signing well before it
+// stops verifying.
+const keyReloadInterval = 10 * time.Second
+
+// sealedKeyPrefix marks a private key encrypted with the key encryption
+// key; rows without it predate encryption and hold plain PEM.
+const sealedKeyPrefix = "aes-gcm:"
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+	retired   bool
+}
+
+// KeyRing signs tokens with the current key and verifies them with any key
+// that has not expired yet, so rotation does not invalidate live tokens.
+type KeyRing struct {
+	repo *repositories.SigningKeyRepo
+	cfg  *config.Config
+	kek  cipher.AEAD // encrypts private keys at rest
+
+	mu         sync.RWMutex
+	keys       map[string]*signingKey
+	active     *signingKey
+	lastLoaded time.Time
+}
+
+func NewKeyRing(repo *repositories.SigningKeyRepo, cfg *config.Config) (*KeyRing, error) {
+	if _, err := signingMethod(cfg.JWTAlgorithm); err != nil {
+		return nil, err
+	}
+	kek, err := newKeyEncryptionKey(cfg.JWTKeyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	k := &KeyRing{repo: repo, cfg: cfg, kek: kek}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	if err := k.RotateIfDue(); err != nil {
+		return nil, err
+	}
+	if k.active == nil {
+		return nil, errors.New("no usable signing key; check JWT_KEY_ENCRYPTION_KEY")
+	}
+	return k, nil
+}
+
+// Run reloads keys and rotates when due until stop is closed.
+func (k *KeyRing) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := k.load(); err != nil {
+				log.Error().Err(err).Msg("Failed to reload signing keys")
+				continue
+			}
+			if err := k.RotateIfDue(); err != nil {
+				log.Error().Err(err).Msg("Failed to rotate signing key")
+			}
+		}
+	}
+}
+
+func (k *KeyRing) RotateIfDue() error {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+	if active != nil && active.method.Alg() == k.cfg.JWTAlgorithm && time.Since(active.createdAt) < k.cfg.JWTRotationPeriod {
+		return nil
+	}
+	return k.Rotate()
+}
+
+func (k *KeyRing) Rotate() error {
+	method, _ := signingMethod(k.cfg.JWTAlgorithm)
+	private, err := generateKey(method)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+	kid, err := utils.GenerateToken(12)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := k.seal(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	if err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	currentKid := ""
+	if k.active != nil {
+		currentKid = k.active.kid
+	}
+	k.mu.RUnlock()
+
+	now := time.Now()
+	next := &models.SigningKey{
+		Kid:        kid,
+		Algorithm:  method.Alg(),
+		PrivateKey: sealed,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})),
+	}
+	rotated, err := k.repo.Rotate(next, currentKid, now, now.Add(k.maxTokenLifetime()))
+	if err != nil {
+		return err
+	}
+	if rotated {
+		log.Info().Str("kid", kid).Str("alg", method.Alg()).Msg("Rotated JWT signing key")
+	}
+	return k.load()
+}
+
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	stale := time.Since(k.lastLoaded) > keyReloadInterval
+	k.mu.RUnlock()
+	if stale {
+		if err := k.load(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload signing keys")
+		}
+	}
+
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+	if active == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.kid
+	return token.SignedString(active.private)
+}
+
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := k.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys that may still verify tokens, as an RFC 7517 key set.
+func (k *KeyRing) JWKS() map[string]interface{} {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]map[string]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwk := map[string]string{"kid": key.kid, "use": "sig", "alg": key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func (k *KeyRing) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	key := k.keys[kid]
+	stale := time.Since(k.lastLoaded) > keyReloadInterval
+	k.mu.RUnlock()
+	if key != nil || kid == "" || !stale {
+		return key
+	}
+	if err := k.load(); err != nil {
+		log.Error().Err(err).Msg("Failed to reload signing keys")
+		return nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+func (k *KeyRing) load() error {
+	now := time.Now()
+	rows, err := k.repo.ListUnexpired(now)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(rows))
+	var active *signingKey
+	for _, row := range rows {
+		key, err := k.parseSigningKey(row)
+		if err != nil {
+			log.Error().Err(err).Str("kid", row.Kid).Msg("Skipping unreadable signing key")
+			continue
+		}
+		keys[key.kid] = key
+		if !key.retired && (active == nil || key.createdAt.After(active.createdAt)) {
+			active = key
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.active = active
+	k.lastLoaded = now
+	k.mu.Unlock()
+	return nil
+}
+
+// maxTokenLifetime bounds how long a retired key must keep verifying.
+func (k *KeyRing) maxTokenLifetime() time.Duration {
+	d := k.cfg.AccessTokenTTL
+	if k.cfg.MFAChallengeTTL > d {
+		d = k.cfg.MFAChallengeTTL
+	}
+	if oidcStateTTL > d {
+		d = oidcStateTTL
+	}
+	if k.cfg.ImpersonationTTL > d {
+		d = k.cfg.ImpersonationTTL
+	}
+	return d + time.Minute
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "RS256":
+		return jwt.SigningMethodRS256, nil
+	case "EdDSA":
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported JWT algorithm %q", alg)
+}
+
+func generateKey(method jwt.SigningMethod) (crypto.Signer, error) {
+	if method == jwt.SigningMethodEdDSA {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// parseSigningKey decrypts and parses a stored key. Keys stored in plain
+// PEM before encryption was introduced are encrypted in place.
+func (k *KeyRing) parseSigningKey(row models.SigningKey) (*signingKey, error) {
+	method, err := signingMethod(row.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	privatePEM := []byte(row.PrivateKey)
+	if strings.HasPrefix(row.PrivateKey, sealedKeyPrefix) {
+		if privatePEM, err = k.open(row.PrivateKey); err != nil {
+			return nil, err
+		}
+	} else if sealed, err := k.seal(privatePEM); err != nil {
+		return nil, err
+	} else if err := k.repo.UpdatePrivateKey(row.ID, sealed); err != nil {
+		log.Error().Err(err).Str("kid", row.Kid).Msg("Failed to encrypt stored signing key")
+	}
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return &signingKey{
+		kid:       row.Kid,
+		method:    method,
+		private:   private,
+		public:    private.Public(),
+		createdAt: row.CreatedAt,
+		retired:   row.RetiredAt != nil,
+	}, nil
+}
+
+// newKeyEncryptionKey reads the base64 AES-256 key that private keys are
+// encrypted with.
+func newKeyEncryptionKey(encoded string) (cipher.AEAD, error) {
+	if encoded == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be set to a base64-encoded 32-byte key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be a base64-encoded 32-byte key")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts a private key PEM for storage.
+func (k *KeyRing) seal(plain []byte) (string, error) {
+	nonce := make([]byte, k.kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.kek.Seal(nonce, nonce, plain, nil)
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *KeyRing) open(stored string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedKeyPrefix))
+	if err != nil || len(raw) < k.kek.NonceSize() {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	nonce, sealed := raw[:k.kek.NonceSize()], raw[k.kek.NonceSize():]
+	plain, err := k.kek.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt private key; check JWT_KEY_ENCRYPTION_KEY")
+	}
+	return plain, nil
+}
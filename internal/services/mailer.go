@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/config"
+)
+
+// Mailer sends plain-text email to an address, for messages that must reach
+// people who do not have an account yet.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return SMTPMailer{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.MailFrom}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.MailDir, 0o700); err != nil {
+			return nil, err
+		}
+		return FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}, nil
+	}
+	return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+}
+
+func formatMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Username string // empty disables authentication
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, formatMessage(m.From, to, subject, body))
+}
+
+// FileMailer drops each message into Dir as an .eml file, for local testing.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(to string, subject string, body string) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), filepath.Base(to))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, to, subject, body), 0o600)
+}
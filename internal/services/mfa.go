@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/utils"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	mfaChallengePurpose = "mfa_challenge"
+	recoveryCodeCount   = 10
+)
+
+var (
+	ErrInvalidMFACode     = errors.New("invalid verification code")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled     = errors.New("two-factor enrollment has not been started")
+	ErrMFAMandatory       = errors.New("two-factor authentication is mandatory for this role")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrInvalidChallenge   = errors.New("invalid or expired challenge token")
+	ErrEnrollmentRequired = errors.New("two-factor enrollment required")
+)
+
+type MFAEnrollment struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (s *AuthService) mfaRequired(role models.Role) bool {
+	return containsString(s.cfg.MFARequiredRoles, string(role))
+}
+
+func (s *AuthService) issueChallenge(user *models.User) (string, error) {
+	now := time.Now()
+	return s.keys.Sign(Claims{
+		UserID:  user.ID,
+		Role:    user.Role,
+		Purpose: mfaChallengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.JWTIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.MFAChallengeTTL)),
+		},
+	})
+}
+
+func (s *AuthService) parseChallenge(challenge string) (*models.User, error) {
+	claims, err := s.parseClaims(challenge)
+	if err != nil || claims.Purpose != mfaChallengePurpose {
+		return nil, ErrInvalidChallenge
+	}
+	user, err := s.repo.FindByID(claims.UserID)
+	if err != nil || user.Disabled {
+		return nil, ErrInvalidChallenge
+	}
+	return user, nil
+}
+
+// VerifyMFA completes a two-step login with a TOTP or recovery code.
+func (s *AuthService) VerifyMFA(challenge string, code string, client ClientInfo) (*LoginResult, error) {
+	ip := client.IP
+	user, err := s.parseChallenge(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guard.Check(user.Username, ip); err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrEnrollmentRequired
+	}
+
+	if err := s.checkSecondFactor(user, code, true); err != nil {
+		s.guard.RecordFailure(user.Username, ip, user.ID)
+		return nil, err
+	}
+
+	tokens, err := s.startSession(user, client, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: tokens}, nil
+}
+
+func (s *AuthService) BeginMFAEnrollment(userID uint) (*MFAEnrollment, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginEnrollment(user)
+}
+
+func (s *AuthService) ConfirmMFAEnrollment(userID uint, code string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.MFAEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return ErrMFANotEnrolled
+	}
+	if err := s.checkSecondFactor(user, code, false); err != nil {
+		return err
+	}
+	user.MFAEnabled = true
+	if err := s.repo.UpdateFields(user, "mfa_enabled"); err != nil {
+		return err
+	}
+	return s.sessionRepo.ClearMFAPending(user.ID)
+}
+
+func (s *AuthService) DisableMFA(userID uint, code string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	if s.mfaRequired(user.Role) {
+		return ErrMFAMandatory
+	}
+	if err := s.checkSecondFactor(user, code, true); err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFALastUsedStep = 0
+	if err := s.repo.UpdateFields(user, "mfa_enabled", "mfa_secret", "mfa_last_used_step"); err != nil {
+		return err
+	}
+	return s.repo.ReplaceRecoveryCodes(user.ID, nil)
+}
+
+func (s *AuthService) beginEnrollment(user *models.User) (*MFAEnrollment, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw, err := utils.GenerateToken(8)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = strings.ToLower(raw[:5] + "-" + raw[5:10])
+		hashes[i] = utils.HashToken(codes[i])
+	}
+
+	user.MFASecret = secret
+	user.MFALastUsedStep = 0
+	if err := s.repo.UpdateFields(user, "mfa_secret", "mfa_last_used_step"); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:        secret,
+		OTPAuthURI:    utils.TOTPURI(s.cfg.MFAIssuer, user.Username, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// checkSecondFactor accepts a TOTP code, or a single-use recovery code when
+// allowRecovery is set. A TOTP code is used up by advancing the user's last
+// used step in the database, so it cannot be replayed.
+func (s *AuthService) checkSecondFactor(user *models.User, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+	if step, ok := utils.ValidateTOTP(user.MFASecret, code, time.Now()); ok {
+		advanced, err := s.repo.AdvanceMFAStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		user.MFALastUsedStep = step
+		return nil
+	}
+	if !allowRecovery {
+		return ErrInvalidMFACode
+	}
+	used, err := s.repo.UseRecoveryCode(user.ID, utils.HashToken(strings.ToLower(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Notifier delivers out-of-band messages such as password reset tokens to a user.
+type Notifier interface {
+	Notify(user *models.User, subject string, body string) error
+}
+
+func NewNotifier(cfg *config.Config) (Notifier, error) {
+	switch cfg.Notifier {
+	case "log":
+		return LogNotifier{}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.NotifierDir, 0o700); err != nil {
+			return nil, err
+		}
+		return FileNotifier{Dir: cfg.NotifierDir}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", cfg.Notifier)
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(user *models.User, subject string, body string) error {
+	log.Info().Uint("user_id", user.ID).Str("username", user.Username).Str("subject", subject).Msg(body)
+	return nil
+}
+
+type FileNotifier struct {
+	Dir string
+}
+
+func (n FileNotifier) Notify(user *models.User, subject string, body string) error {
+	name := fmt.Sprintf("%s-user-%d.txt", time.Now().UTC().Format("20060102T150405.000000000"), user.ID)
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", user.Username, subject, body)
+	return os.WriteFile(filepath.Join(n.Dir, name), []byte(content), 0o600)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("organization already exists")
+	ErrNotMember            = errors.New("user is not a member of this organization")
+	ErrNotCustomer          = errors.New("only users who can create submissions can join an organization")
+)
+
+type OrganizationService struct {
+	repo     *repositories.OrganizationRepo
+	userRepo *repositories.UserRepo
+	access   *PolicyService
+}
+
+func NewOrganizationService(repo *repositories.OrganizationRepo, userRepo *repositories.UserRepo, access *PolicyService) *OrganizationService {
+	return &OrganizationService{repo: repo, userRepo: userRepo, access: access}
+}
+
+func (s *OrganizationService) Create(name string) (*models.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	exists, err := s.repo.NameExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrOrganizationExists
+	}
+	org := &models.Organization{Name: name}
+	if err := s.repo.Create(org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *OrganizationService) List(limit int, offset int) ([]models.Organization, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.List(limit, offset)
+}
+
+func (s *OrganizationService) Get(id uint) (*models.Organization, error) {
+	org, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, err
+}
+
+func (s *OrganizationService) Members(id uint) ([]models.User, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	return s.repo.Members(id)
+}
+
+// AddMember moves a customer into the organization. A user belongs to at most
+// one organization, so this also removes them from any previous one.
+func (s *OrganizationService) AddMember(id uint, userID uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !s.access.Can(user.Role, models.PermSubmissionCreate) {
+		return ErrNotCustomer
+	}
+	return s.repo.SetMembership(userID, &id)
+}
+
+func (s *OrganizationService) RemoveMember(id uint, userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if user.OrganizationID == nil || *user.OrganizationID != id {
+		return ErrNotMember
+	}
+	return s.repo.SetMembership(userID, nil)
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Grants are cached in memory and reloaded at least this often, so edits made
+// through another instance take effect without a restart.
+const policyReloadInterval = 30 * time.Second
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
+	ErrBuiltinRole       = errors.New("built-in roles cannot be deleted")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrLockout           = errors.New("the admin role must keep role.manage")
+)
+
+type RoleWithPermissions struct {
+	models.RoleDefinition
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// PolicyService is the single place that decides whether a role holds a
+// permission. Roles and their grants are data, editable by admins.
+type PolicyService struct {
+	repo *repositories.RoleRepo
+
+	mu       sync.RWMutex
+	roles    map[models.Role]bool
+	grants   map[models.Role]map[models.Permission]bool
+	loadedAt time.Time
+}
+
+func NewPolicyService(repo *repositories.RoleRepo) (*PolicyService, error) {
+	p := &PolicyService{repo: repo}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PolicyService) Can(role models.Role, perm models.Permission) bool {
+	p.refresh()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.grants[role][perm]
+}
+
+// CanAct is Can for a live request: impersonation sessions never get
+// sensitive permissions such as approving submissions.
+func (p *PolicyService) CanAct(role models.Role, perm models.Permission, impersonated bool) bool {
+	if impersonated && models.IsSensitivePermission(perm) {
+		return false
+	}
+	return p.Can(role, perm)
+}
+
+func (p *PolicyService) RoleExists(role models.Role) bool {
+	p.refresh()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.roles[role]
+}
+
+func (p *PolicyService) ListRoles() ([]RoleWithPermissions, error) {
+	roles, err := p.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	grants, err := p.repo.AllPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	byRole := map[models.Role][]models.Permission{}
+	for _, g := range grants {
+		byRole[g.Role] = append(byRole[g.Role], g.Permission)
+	}
+	result := make([]RoleWithPermissions, len(roles))
+	for i, r := range roles {
+		perms := byRole[r.Name]
+		if perms == nil {
+			perms = []models.Permission{}
+		}
+		result[i] = RoleWithPermissions{RoleDefinition: r, Permissions: perms}
+	}
+	return result, nil
+}
+
+func (p *PolicyService) CreateRole(name models.Role, description string, permissions []models.Permission) (*RoleWithPermissions, error) {
+	if !roleNamePattern.MatchString(string(name)) {
+		return nil, errors.New("role name must be lowercase letters, digits or underscores")
+	}
+	permissions, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if p.RoleExists(name) {
+		return nil, ErrRoleExists
+	}
+
+	role := &models.RoleDefinition{Name: name, Description: strings.TrimSpace(description)}
+	if err := p.repo.Create(role, permissions); err != nil {
+		return nil, err
+	}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return &RoleWithPermissions{RoleDefinition: *role, Permissions: permissions}, nil
+}
+
+func (p *PolicyService) SetPermissions(name models.Role, permissions []models.Permission) error {
+	role, err := p.findRole(name)
+	if err != nil {
+		return err
+	}
+	permissions, err = normalizePermissions(permissions)
+	if err != nil {
+		return err
+	}
+	if role.Name == models.Admin && !containsPermission(permissions, models.PermRoleManage) {
+		return ErrLockout
+	}
+	if err := p.repo.SetPermissions(role.Name, permissions); err != nil {
+		return err
+	}
+	return p.reload()
+}
+
+func (p *PolicyService) DeleteRole(name models.Role) error {
+	role, err := p.findRole(name)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	count, err := p.repo.CountUsers(role.Name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	if err := p.repo.Delete(role); err != nil {
+		return err
+	}
+	return p.reload()
+}
+
+func (p *PolicyService) findRole(name models.Role) (*models.RoleDefinition, error) {
+	role, err := p.repo.FindByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+func (p *PolicyService) refresh() {
+	p.mu.RLock()
+	stale := time.Since(p.loadedAt) > policyReloadInterval
+	p.mu.RUnlock()
+	if stale {
+		if err := p.reload(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload role permissions")
+		}
+	}
+}
+
+func (p *PolicyService) reload() error {
+	roles, err := p.repo.List()
+	if err != nil {
+		return err
+	}
+	grants, err := p.repo.AllPermissions()
+	if err != nil {
+		return err
+	}
+
+	roleSet := make(map[models.Role]bool, len(roles))
+	for _, r := range roles {
+		roleSet[r.Name] = true
+	}
+	grantMap := map[models.Role]map[models.Permission]bool{}
+	for _, g := range grants {
+		if grantMap[g.Role] == nil {
+			grantMap[g.Role] = map[models.Permission]bool{}
+		}
+		grantMap[g.Role][g.Permission] = true
+	}
+
+	p.mu.Lock()
+	p.roles = roleSet
+	p.grants = grantMap
+	p.loadedAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// normalizePermissions rejects unknown permissions and drops duplicates.
+func normalizePermissions(permissions []models.Permission) ([]models.Permission, error) {
+	result := make([]models.Permission, 0, len(permissions))
+	for _, perm := range permissions {
+		if !models.IsKnownPermission(perm) {
+			return nil, ErrUnknownPermission
+		}
+		if !containsPermission(result, perm) {
+			result = append(result, perm)
+		}
+	}
+	return result, nil
+}
+
+func containsPermission(permissions []models.Permission, target models.Permission) bool {
+	for _, p := range permissions {
+		if p == target {
+			return true
+		}
+	}
+	return false
+}
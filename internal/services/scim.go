@@ -0,0 +1,709 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/repositories"
+)
+
+// SCIM provisioning manages the staff accounts that sign in through the
+// identity provider. A user's externalId must be its OIDC subject so SSO logins
+// land on the provisioned account. Groups are roles: adding a user to a group
+// assigns that role, removing it falls back to the configured default role.
+const (
+	SCIMUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimMaxPageSize     = 200
+	scimMaxGroupMembers = 10000
+)
+
+var (
+	scimFilterPattern       = regexp.MustCompile(`^\s*(\w+)\s+eq\s+"([^"]*)"\s*$`)
+	scimMemberFilterPattern = regexp.MustCompile(`^members\[value eq "([^"]*)"\]$`)
+)
+
+// SCIMError is rendered as a SCIM error response with its HTTP status.
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimErr(status int, scimType string, format string, args ...interface{}) *SCIMError {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type SCIMUser struct {
+	Schemas    []string    `json:"schemas"`
+	ID         string      `json:"id,omitempty"`
+	ExternalID string      `json:"externalId,omitempty"`
+	UserName   string      `json:"userName"`
+	Active     *bool       `json:"active,omitempty"` // absent means active
+	Emails     []SCIMEmail `json:"emails,omitempty"`
+	Groups     []SCIMRef   `json:"groups,omitempty"` // read-only, managed through /Groups
+	Meta       *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Members     []SCIMRef `json:"members"`
+	Meta        *SCIMMeta `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMPatch struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []SCIMPatchOp `json:"Operations"`
+}
+
+type SCIMPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Changes made through SCIM are attributed to this service account. It is
+// disabled and has no password, so nobody can log in as it.
+const (
+	scimActorUsername = "scim-provisioning"
+	serviceProvider   = "service"
+)
+
+type SCIMService struct {
+	repo   *repositories.UserRepo
+	auth   *AuthService
+	access *PolicyService
+	audit  *AuditService
+	cfg    *config.Config
+	actor  *models.User
+}
+
+func NewSCIMService(repo *repositories.UserRepo, auth *AuthService, access *PolicyService, audit *AuditService, cfg *config.Config) (*SCIMService, error) {
+	actor, err := repo.FindOrCreateServiceAccount(scimActorUsername, serviceProvider, models.Customer)
+	if err != nil {
+		return nil, fmt.Errorf("SCIM service account: %w", err)
+	}
+	return &SCIMService{repo: repo, auth: auth, access: access, audit: audit, cfg: cfg, actor: actor}, nil
+}
+
+// parseFilter supports the single `attr eq "value"` form that provisioning
+// clients use to look resources up before creating them.
+func parseFilter(filter string, allowed ...string) (string, string, error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	m := scimFilterPattern.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", scimErr(http.StatusBadRequest, "invalidFilter", "unsupported filter %q", filter)
+	}
+	for _, attr := range allowed {
+		if strings.EqualFold(m[1], attr) {
+			return attr, m[2], nil
+		}
+	}
+	return "", "", scimErr(http.StatusBadRequest, "invalidFilter", "cannot filter on %q", m[1])
+}
+
+func page(startIndex int, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count == 0 || count > scimMaxPageSize {
+		count = scimMaxPageSize
+	}
+	return startIndex, count
+}
+
+func (s *SCIMService) toSCIMUser(user *models.User) *SCIMUser {
+	active := !user.Disabled
+	out := &SCIMUser{
+		Schemas:    []string{SCIMUserSchema},
+		ID:         strconv.FormatUint(uint64(user.ID), 10),
+		ExternalID: user.ExternalID,
+		UserName:   user.Username,
+		Active:     &active,
+		Groups:     []SCIMRef{{Value: string(user.Role), Display: string(user.Role)}},
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     fmt.Sprintf("%s/scim/v2/Users/%d", s.cfg.AppBaseURL, user.ID),
+		},
+	}
+	if user.Email != "" {
+		out.Emails = []SCIMEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	return out
+}
+
+func primaryEmail(emails []SCIMEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// findUser only resolves accounts owned by the identity provider; customers
+// and local staff accounts are invisible to SCIM.
+func (s *SCIMService) findUser(id string) (*models.User, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, scimErr(http.StatusNotFound, "", "user %s not found", id)
+	}
+	user, err := s.auth.GetUser(uint(n))
+	if errors.Is(err, ErrUserNotFound) || (err == nil && user.AuthProvider != oidcProvider) {
+		return nil, scimErr(http.StatusNotFound, "", "user %s not found", id)
+	}
+	return user, err
+}
+
+func (s *SCIMService) ListUsers(filter string, startIndex int, count int) (*SCIMListResponse, error) {
+	attr, value, err := parseFilter(filter, "userName", "externalId")
+	if err != nil {
+		return nil, err
+	}
+	var username, externalID string
+	switch attr {
+	case "userName":
+		username = value
+	case "externalId":
+		externalID = value
+	}
+	startIndex, count = page(startIndex, count)
+	users, total, err := s.repo.ListProvisioned(oidcProvider, username, externalID, nil, count, startIndex-1)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*SCIMUser, len(users))
+	for i := range users {
+		resources[i] = s.toSCIMUser(&users[i])
+	}
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func (s *SCIMService) GetUser(id string) (*SCIMUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(user), nil
+}
+
+func (s *SCIMService) CreateUser(in SCIMUser) (*SCIMUser, error) {
+	username := strings.TrimSpace(in.UserName)
+	if username == "" {
+		return nil, scimErr(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	if in.ExternalID == "" {
+		return nil, scimErr(http.StatusBadRequest, "invalidValue", "externalId is required and must be the user's OIDC subject")
+	}
+	if err := s.checkUnique(username, in.ExternalID, 0); err != nil {
+		return nil, err
+	}
+	role := models.Role(s.cfg.SCIMDefaultRole)
+	if !s.access.RoleExists(role) {
+		return nil, fmt.Errorf("SCIM_DEFAULT_ROLE %q is not a known role", role)
+	}
+
+	user := &models.User{
+		Username:     username,
+		Role:         role,
+		Disabled:     in.Active != nil && !*in.Active,
+		AuthProvider: oidcProvider,
+		ExternalID:   in.ExternalID,
+		SCIMManaged:  true,
+	}
+	setEmail(user, primaryEmail(in.Emails))
+	if err := s.repo.Create(user); err != nil {
+		return nil, err
+	}
+	remarks := fmt.Sprintf("%s as %s through SCIM", user.Username, user.Role)
+	if user.Disabled {
+		remarks += ", inactive"
+	}
+	if err := s.record(user.ID, "Account Created", remarks); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(user), nil
+}
+
+func (s *SCIMService) checkUnique(username string, externalID string, selfID uint) error {
+	users, _, err := s.repo.ListProvisioned(oidcProvider, "", externalID, nil, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 && users[0].ID != selfID {
+		return scimErr(http.StatusConflict, "uniqueness", "externalId %q is already provisioned", externalID)
+	}
+	if existing, err := s.repo.FindByUsername(username); err == nil && existing.ID == selfID {
+		return nil
+	}
+	taken, err := s.repo.UsernameExists(username)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return scimErr(http.StatusConflict, "uniqueness", "userName %q is already taken", username)
+	}
+	return nil
+}
+
+// setEmail records an IdP-asserted address, which needs no verification.
+func setEmail(user *models.User, email string) {
+	if email == user.Email {
+		return
+	}
+	user.Email = strings.ToLower(email)
+	user.EmailVerifiedAt = nil
+	if email != "" {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+}
+
+// ReplaceUser implements PUT: every writable attribute takes the new value.
+func (s *SCIMService) ReplaceUser(id string, in SCIMUser) (*SCIMUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+	username := strings.TrimSpace(in.UserName)
+	if username == "" {
+		return nil, scimErr(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	externalID := in.ExternalID
+	if externalID == "" {
+		externalID = user.ExternalID
+	}
+	if err := s.checkUnique(username, externalID, user.ID); err != nil {
+		return nil, err
+	}
+	user.Username = username
+	user.ExternalID = externalID
+	setEmail(user, primaryEmail(in.Emails))
+	return s.save(&before, user, in.Active == nil || *in.Active)
+}
+
+// save stores attribute changes made to user since it was loaded as before,
+// and applies activation separately so that deactivation also ends the
+// user's sessions. Each is audited.
+func (s *SCIMService) save(before *models.User, user *models.User, active bool) (*SCIMUser, error) {
+	user.SCIMManaged = true
+	if err := s.repo.UpdateFields(user, "username", "external_id", "email", "email_verified_at", "scim_managed"); err != nil {
+		return nil, err
+	}
+	if changes := attributeChanges(before, user); len(changes) > 0 {
+		if err := s.record(user.ID, "Account Updated", strings.Join(changes, ", ")+" through SCIM"); err != nil {
+			return nil, err
+		}
+	}
+	if active == user.Disabled {
+		updated, err := s.auth.SetDisabled(s.actor.ID, user.ID, !active)
+		if err != nil {
+			return nil, err
+		}
+		user = updated
+		action := "Account Enabled"
+		if !active {
+			action = "Account Disabled"
+		}
+		if err := s.record(user.ID, action, "Set through SCIM"); err != nil {
+			return nil, err
+		}
+	}
+	return s.toSCIMUser(user), nil
+}
+
+// attributeChanges describes the stored attributes that differ between
+// before and after.
+func attributeChanges(before *models.User, after *models.User) []string {
+	var changes []string
+	for _, attr := range []struct{ name, from, to string }{
+		{"userName", before.Username, after.Username},
+		{"externalId", before.ExternalID, after.ExternalID},
+		{"email", before.Email, after.Email},
+	} {
+		if attr.from != attr.to {
+			changes = append(changes, fmt.Sprintf("%s %q to %q", attr.name, attr.from, attr.to))
+		}
+	}
+	return changes
+}
+
+// record audits a change to a user, attributed to the SCIM service account.
+func (s *SCIMService) record(userID uint, action string, remarks string) error {
+	return s.audit.Record(0, s.actor.ID, userID, action, remarks)
+}
+
+// setRole assigns a role through SCIM; from then on the user's role is
+// managed here and SSO logins no longer change it.
+func (s *SCIMService) setRole(user *models.User, role models.Role) error {
+	if !user.SCIMManaged {
+		user.SCIMManaged = true
+		if err := s.repo.UpdateFields(user, "scim_managed"); err != nil {
+			return err
+		}
+	}
+	from := user.Role
+	if _, err := s.auth.UpdateRole(s.actor.ID, user.ID, role); err != nil {
+		return err
+	}
+	return s.record(user.ID, "Role Changed", fmt.Sprintf("%s to %s through SCIM", from, role))
+}
+
+func (s *SCIMService) PatchUser(id string, patch SCIMPatch) (*SCIMUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+	active := !user.Disabled
+	for _, op := range patch.Operations {
+		if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+			return nil, scimErr(http.StatusBadRequest, "invalidValue", "unsupported operation %q on User", op.Op)
+		}
+		// Without a path the value is an object of attributes to set.
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return nil, scimErr(http.StatusBadRequest, "invalidValue", "value must be an object when no path is given")
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+		for path, raw := range values {
+			if err := s.applyUserAttribute(user, &active, path, raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.checkUnique(user.Username, user.ExternalID, user.ID); err != nil {
+		return nil, err
+	}
+	return s.save(&before, user, active)
+}
+
+func (s *SCIMService) applyUserAttribute(user *models.User, active *bool, path string, raw json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "active":
+		v, err := scimBool(raw)
+		if err != nil {
+			return err
+		}
+		*active = v
+	case "username":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil || strings.TrimSpace(v) == "" {
+			return scimErr(http.StatusBadRequest, "invalidValue", "userName must be a non-empty string")
+		}
+		user.Username = strings.TrimSpace(v)
+	case "externalid":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil || v == "" {
+			return scimErr(http.StatusBadRequest, "invalidValue", "externalId must be a non-empty string")
+		}
+		user.ExternalID = v
+	case "emails":
+		var v []SCIMEmail
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", "emails must be a list")
+		}
+		setEmail(user, primaryEmail(v))
+	case `emails[type eq "work"].value`:
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", "email must be a string")
+		}
+		setEmail(user, v)
+	default:
+		// Attributes this service does not store (name, title, ...) are ignored.
+	}
+	return nil
+}
+
+// scimBool accepts JSON booleans and the "True"/"False" strings some
+// provisioning clients send.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if v, err := strconv.ParseBool(str); err == nil {
+			return v, nil
+		}
+	}
+	return false, scimErr(http.StatusBadRequest, "invalidValue", "active must be a boolean")
+}
+
+func (s *SCIMService) DeleteUser(id string) error {
+	user, err := s.findUser(id)
+	if err != nil {
+		return err
+	}
+	if err := s.auth.DeleteUser(s.actor.ID, user.ID); err != nil {
+		return err
+	}
+	return s.record(user.ID, "Account Deleted", "Deleted through SCIM")
+}
+
+func (s *SCIMService) toSCIMGroup(role RoleWithPermissions) (*SCIMGroup, error) {
+	members, _, err := s.repo.ListProvisioned(oidcProvider, "", "", &role.Name, scimMaxGroupMembers, 0)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]SCIMRef, len(members))
+	for i, m := range members {
+		refs[i] = SCIMRef{Value: strconv.FormatUint(uint64(m.ID), 10), Display: m.Username}
+	}
+	return &SCIMGroup{
+		Schemas:     []string{SCIMGroupSchema},
+		ID:          string(role.Name),
+		DisplayName: string(role.Name),
+		Members:     refs,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Created:      &role.CreatedAt,
+			LastModified: &role.UpdatedAt,
+			Location:     fmt.Sprintf("%s/scim/v2/Groups/%s", s.cfg.AppBaseURL, role.Name),
+		},
+	}, nil
+}
+
+func (s *SCIMService) findRole(id string) (*RoleWithPermissions, error) {
+	roles, err := s.access.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		if string(roles[i].Name) == id {
+			return &roles[i], nil
+		}
+	}
+	return nil, scimErr(http.StatusNotFound, "", "group %s not found", id)
+}
+
+func (s *SCIMService) ListGroups(filter string, startIndex int, count int) (*SCIMListResponse, error) {
+	_, displayName, err := parseFilter(filter, "displayName")
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.access.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	var matched []RoleWithPermissions
+	for _, r := range roles {
+		if filter == "" || string(r.Name) == displayName {
+			matched = append(matched, r)
+		}
+	}
+
+	startIndex, count = page(startIndex, count)
+	resources := []*SCIMGroup{}
+	for i := startIndex - 1; i < len(matched) && len(resources) < count; i++ {
+		group, err := s.toSCIMGroup(matched[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, group)
+	}
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMListSchema},
+		TotalResults: int64(len(matched)),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func (s *SCIMService) GetGroup(id string) (*SCIMGroup, error) {
+	role, err := s.findRole(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(*role)
+}
+
+// ReplaceGroup implements PUT: the listed users get the role and everyone
+// else holding it falls back to the default role.
+func (s *SCIMService) ReplaceGroup(id string, in SCIMGroup) (*SCIMGroup, error) {
+	role, err := s.findRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if in.DisplayName != "" && in.DisplayName != string(role.Name) {
+		return nil, scimErr(http.StatusBadRequest, "mutability", "groups mirror roles and cannot be renamed")
+	}
+	if err := s.replaceMembers(role.Name, in.Members); err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(*role)
+}
+
+func (s *SCIMService) PatchGroup(id string, patch SCIMPatch) (*SCIMGroup, error) {
+	role, err := s.findRole(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range patch.Operations {
+		if err := s.applyGroupOp(role.Name, op); err != nil {
+			return nil, err
+		}
+	}
+	return s.toSCIMGroup(*role)
+}
+
+func (s *SCIMService) applyGroupOp(role models.Role, op SCIMPatchOp) error {
+	var refs []SCIMRef
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &refs); err != nil {
+			// Some clients wrap the list as {"members": [...]}.
+			var wrapped struct {
+				Members []SCIMRef `json:"members"`
+			}
+			if err := json.Unmarshal(op.Value, &wrapped); err != nil {
+				return scimErr(http.StatusBadRequest, "invalidValue", "members must be a list of {\"value\": id}")
+			}
+			refs = wrapped.Members
+		}
+	}
+
+	path := strings.TrimSpace(op.Path)
+	switch strings.ToLower(op.Op) {
+	case "add":
+		if path != "" && !strings.EqualFold(path, "members") {
+			return scimErr(http.StatusBadRequest, "invalidPath", "only members can be changed")
+		}
+		return s.assignRole(refs, role)
+	case "replace":
+		if path != "" && !strings.EqualFold(path, "members") {
+			return scimErr(http.StatusBadRequest, "mutability", "groups mirror roles and only their members can change")
+		}
+		return s.replaceMembers(role, refs)
+	case "remove":
+		if m := scimMemberFilterPattern.FindStringSubmatch(path); m != nil {
+			refs = []SCIMRef{{Value: m[1]}}
+		} else if !strings.EqualFold(path, "members") {
+			return scimErr(http.StatusBadRequest, "invalidPath", "only members can be removed")
+		} else if len(refs) == 0 {
+			return s.replaceMembers(role, nil)
+		}
+		return s.unassignRole(refs, role)
+	}
+	return scimErr(http.StatusBadRequest, "invalidValue", "unsupported operation %q on Group", op.Op)
+}
+
+func (s *SCIMService) assignRole(refs []SCIMRef, role models.Role) error {
+	for _, ref := range refs {
+		user, err := s.findUser(ref.Value)
+		if err != nil {
+			return err
+		}
+		if user.Role == role {
+			continue
+		}
+		if err := s.setRole(user, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SCIMService) unassignRole(refs []SCIMRef, role models.Role) error {
+	fallback := models.Role(s.cfg.SCIMDefaultRole)
+	for _, ref := range refs {
+		user, err := s.findUser(ref.Value)
+		if err != nil {
+			return err
+		}
+		if user.Role != role || role == fallback {
+			continue
+		}
+		if err := s.setRole(user, fallback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SCIMService) replaceMembers(role models.Role, refs []SCIMRef) error {
+	keep := map[string]bool{}
+	for _, ref := range refs {
+		keep[ref.Value] = true
+	}
+	current, _, err := s.repo.ListProvisioned(oidcProvider, "", "", &role, scimMaxGroupMembers, 0)
+	if err != nil {
+		return err
+	}
+	var removed []SCIMRef
+	for _, u := range current {
+		if id := strconv.FormatUint(uint64(u.ID), 10); !keep[id] {
+			removed = append(removed, SCIMRef{Value: id})
+		}
+	}
+	if err := s.unassignRole(removed, role); err != nil {
+		return err
+	}
+	return s.assignRole(refs, role)
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+// sessionTouchInterval limits how often authenticated requests write the
+// session's last-seen time.
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the user's active sessions, flagging the one making
+// the request.
+func (s *AuthService) ListSessions(userID uint, currentID uint) ([]SessionView, error) {
+	sessions, err := s.sessionRepo.ListActiveForUser(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	views := make([]SessionView, len(sessions))
+	for i, session := range sessions {
+		views[i] = SessionView{Session: session, Current: session.ID == currentID}
+	}
+	return views, nil
+}
+
+func (s *AuthService) RevokeSession(userID uint, id uint) error {
+	rows, err := s.sessionRepo.RevokeForUser(id, userID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *AuthService) RevokeOtherSessions(userID uint, currentID uint) error {
+	return s.sessionRepo.RevokeOthersForUser(userID, currentID)
+}
+
+// RevokeAllSessions signs a user out everywhere; access tokens stop working
+// on their next request because the middleware checks the session.
+func (s *AuthService) RevokeAllSessions(id uint) error {
+	if _, err := s.GetUser(id); err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeAllForUser(id)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
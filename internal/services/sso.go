@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/utils"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcProvider     = "oidc"
+	oidcStatePurpose = "oidc_state"
+	oidcStateTTL     = 10 * time.Minute
+)
+
+type oidcStateClaims struct {
+	Purpose  string `json:"purpose"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+func (s *AuthService) OIDCEnabled() bool {
+	return s.oidc != nil
+}
+
+// BeginOIDCLogin returns the provider URL to redirect to and a signed cookie
+// value binding the state, nonce and PKCE verifier to the browser.
+func (s *AuthService) BeginOIDCLogin(loginHint string) (string, string, error) {
+	state, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := s.oidc.AuthCodeURL(state, nonce, verifier, loginHint)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	cookie, err := s.keys.Sign(oidcStateClaims{
+		Purpose:  oidcStatePurpose,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.JWTIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, cookie, nil
+}
+
+func (s *AuthService) CompleteOIDCLogin(cookie, state, code string, client ClientInfo) (*LoginResult, error) {
+	claims, err := s.exchangeOIDCCode(cookie, state, code)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.provisionOIDCUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.startSession(user, client, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: tokens}, nil
+}
+
+// exchangeOIDCCode checks the callback state against the signed cookie and
+// redeems the code with the PKCE verifier and nonce bound to it.
+func (s *AuthService) exchangeOIDCCode(cookie, state, code string) (jwt.MapClaims, error) {
+	stored := &oidcStateClaims{}
+	token, err := jwt.ParseWithClaims(cookie, stored, s.keys.Keyfunc)
+	if err != nil || !token.Valid || stored.Purpose != oidcStatePurpose || stored.State == "" || stored.State != state {
+		return nil, fmt.Errorf("%w: invalid state", ErrOIDCLogin)
+	}
+
+	claims, err := s.oidc.Exchange(code, stored.Verifier, stored.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+	return claims, nil
+}
+
+// provisionOIDCUser finds or creates the local user for the IdP subject and
+// keeps its role in sync with the user's current groups. Users provisioned
+// through SCIM get their role from SCIM groups only, so logins do not undo
+// what provisioning set.
+func (s *AuthService) provisionOIDCUser(claims jwt.MapClaims) (*models.User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: id_token has no subject", ErrOIDCLogin)
+	}
+
+	user, err := s.repo.FindByExternalID(oidcProvider, subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user != nil && user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if user != nil && user.SCIMManaged {
+		return user, nil
+	}
+
+	role, ok := s.mapOIDCRole(claims[s.cfg.OIDCGroupsClaim])
+	if !ok {
+		return nil, fmt.Errorf("%w: none of your groups grant access", ErrOIDCLogin)
+	}
+	if user == nil {
+		return s.createOIDCUser(claims, subject, role)
+	}
+	if user.Role != role {
+		user.Role = role
+		if err := s.repo.UpdateFields(user, "role"); err != nil {
+			return nil, err
+		}
+		// Outstanding tokens still carry the old role.
+		if err := s.sessionRepo.RevokeAllForUser(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *AuthService) createOIDCUser(claims jwt.MapClaims, subject string, role models.Role) (*models.User, error) {
+	username, _ := claims["preferred_username"].(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		username = subject
+	}
+
+	// Never attach an IdP identity to an existing local account by name.
+	exists, err := s.repo.UsernameExists(username)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: username %q is already taken by another account", ErrOIDCLogin, username)
+	}
+
+	user := &models.User{
+		Username:     username,
+		Role:         role,
+		AuthProvider: oidcProvider,
+		ExternalID:   subject,
+	}
+	if err := s.repo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// mapOIDCRole returns the role of the first OIDC_ROLE_MAPPING entry whose
+// group is in the claim and whose role exists.
+func (s *AuthService) mapOIDCRole(claim interface{}) (models.Role, bool) {
+	var groups []string
+	switch v := claim.(type) {
+	case string:
+		groups = []string{v}
+	case []interface{}:
+		for _, g := range v {
+			if str, ok := g.(string); ok {
+				groups = append(groups, str)
+			}
+		}
+	}
+
+	for _, entry := range s.cfg.OIDCRoleMapping {
+		group, role, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if !containsString(groups, strings.TrimSpace(group)) {
+			continue
+		}
+		r := models.Role(strings.TrimSpace(role))
+		if !s.access.RoleExists(r) {
+			// A stale entry must not hide a later one that still works.
+			log.Warn().Str("mapping", entry).Msg("OIDC_ROLE_MAPPING names an unknown role; skipping it")
+			continue
+		}
+		return r, true
+	}
+	return "", false
+}
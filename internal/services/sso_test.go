@@ -0,0 +1,190 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"rcs-onboarding/internal/config"
+	"rcs-onboarding/internal/mockoidc"
+	"rcs-onboarding/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// newOIDCTestService wires an AuthService to a mock provider served over
+// HTTP, with in-memory signing keys and roles.
+func newOIDCTestService(t *testing.T) *AuthService {
+	t.Helper()
+	var provider *mockoidc.Provider
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	provider, err := mockoidc.NewProvider(srv.URL, mockoidc.ParseUsers(
+		"tpm.jane=rcs-tpm,sales.joe=rcs-sales,ops.ann=rcs-admins|rcs-tpm,guest.bob=rcs-guests,old.sam=rcs-legacy|rcs-sales,old.max=rcs-legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		JWTIssuer:        "rcs-onboarding",
+		JWTAlgorithm:     "EdDSA",
+		OIDCIssuerURL:    srv.URL,
+		OIDCClientID:     "rcs-onboarding",
+		OIDCClientSecret: "secret",
+		OIDCRedirectURL:  "http://app.test/api/v1/auth/oidc/callback",
+		OIDCScopes:       []string{"openid", "profile", "groups"},
+		OIDCGroupsClaim:  "groups",
+		OIDCRoleMapping:  []string{"rcs-legacy=auditor", "rcs-admins=admin", "rcs-tpm=tpm", "rcs-sales=sales"},
+	}
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &signingKey{kid: "test", method: jwt.SigningMethodEdDSA, private: private, public: private.Public(), createdAt: time.Now()}
+	keys := &KeyRing{cfg: cfg, keys: map[string]*signingKey{key.kid: key}, active: key, lastLoaded: time.Now()}
+	access := &PolicyService{
+		roles:    map[models.Role]bool{models.Admin: true, models.TPM: true, models.Sales: true},
+		loadedAt: time.Now(),
+	}
+	return &AuthService{cfg: cfg, keys: keys, oidc: NewOIDCClient(cfg), access: access}
+}
+
+// authorize starts a login for loginHint and follows the provider's
+// authorization endpoint, returning the state cookie and callback parameters.
+func authorize(t *testing.T, s *AuthService, loginHint string) (cookie string, callback url.Values) {
+	t.Helper()
+	authURL, cookie, err := s.BeginOIDCLogin(loginHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" || q.Get("state") == "" {
+		t.Fatalf("authorization URL lacks PKCE, nonce or state: %s", authURL)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %s", resp.Status)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != s.cfg.OIDCRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, s.cfg.OIDCRedirectURL)
+	}
+	callback = location.Query()
+	if callback.Get("state") != q.Get("state") {
+		t.Fatalf("callback state %q, want %q", callback.Get("state"), q.Get("state"))
+	}
+	return cookie, callback
+}
+
+func TestOIDCLoginMapsGroupsToRoles(t *testing.T) {
+	s := newOIDCTestService(t)
+	tests := []struct {
+		user   string
+		role   models.Role
+		access bool
+	}{
+		{"tpm.jane", models.TPM, true},
+		{"sales.joe", models.Sales, true},
+		{"ops.ann", models.Admin, true}, // first matching mapping wins
+		{"guest.bob", "", false},
+		{"old.sam", models.Sales, true}, // the stale auditor mapping is skipped
+		{"old.max", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			cookie, callback := authorize(t, s, tt.user)
+			claims, err := s.exchangeOIDCCode(cookie, callback.Get("state"), callback.Get("code"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub, _ := claims["sub"].(string); sub != "mock|"+tt.user {
+				t.Errorf("sub = %q, want %q", sub, "mock|"+tt.user)
+			}
+			role, ok := s.mapOIDCRole(claims[s.cfg.OIDCGroupsClaim])
+			if role != tt.role || ok != tt.access {
+				t.Errorf("mapOIDCRole = %q, %v; want %q, %v", role, ok, tt.role, tt.access)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRejectsTamperedCallbacks(t *testing.T) {
+	s := newOIDCTestService(t)
+	// resign rewrites the state cookie as if it had been issued differently.
+	resign := func(t *testing.T, cookie string, edit func(*oidcStateClaims)) string {
+		t.Helper()
+		stored := &oidcStateClaims{}
+		if _, err := jwt.ParseWithClaims(cookie, stored, s.keys.Keyfunc); err != nil {
+			t.Fatal(err)
+		}
+		edit(stored)
+		signed, err := s.keys.Sign(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, cookie, state, code string) (string, string, string)
+	}{
+		{"state mismatch", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return cookie, "forged", code
+		}},
+		{"missing cookie", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return "", state, code
+		}},
+		{"unsigned cookie", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, oidcStateClaims{Purpose: oidcStatePurpose, State: state}).SignedString([]byte("x"))
+			return forged, state, code
+		}},
+		{"cookie for another purpose", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return resign(t, cookie, func(c *oidcStateClaims) { c.Purpose = "mfa" }), state, code
+		}},
+		{"wrong PKCE verifier", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return resign(t, cookie, func(c *oidcStateClaims) { c.Verifier = "not-the-verifier" }), state, code
+		}},
+		{"wrong nonce", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return resign(t, cookie, func(c *oidcStateClaims) { c.Nonce = "not-the-nonce" }), state, code
+		}},
+		{"replayed code", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			if _, err := s.exchangeOIDCCode(cookie, state, code); err != nil {
+				t.Fatal(err)
+			}
+			return cookie, state, code
+		}},
+		{"unknown code", func(t *testing.T, cookie, state, code string) (string, string, string) {
+			return cookie, state, "made-up"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie, callback := authorize(t, s, "tpm.jane")
+			cookie, state, code := tt.tamper(t, cookie, callback.Get("state"), callback.Get("code"))
+			if _, err := s.exchangeOIDCCode(cookie, state, code); !errors.Is(err, ErrOIDCLogin) {
+				t.Errorf("exchangeOIDCCode error = %v, want ErrOIDCLogin", err)
+			}
+		})
+	}
+}
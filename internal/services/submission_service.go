@@ -9,25 +9,85 @@ import (
 	"rcs-onboarding/internal/models"
 	"rcs-onboarding/internal/repositories"
 	"rcs-onboarding/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoOrganization   = errors.New("your account is not linked to an organization")
+	ErrEmailNotVerified = errors.New("verify your email address before creating submissions")
+	ErrPinnedRetired    = errors.New("the version this draft is pinned to was retired; unpin it to continue")
+	ErrDataVersion      = errors.New("data must be for the draft's own version or the one it is saved on")
 )
 
 type SubmissionService struct {
 	subRepo   *repositories.SubmissionRepo
 	formRepo  *repositories.FormRepo
-	auditRepo *repositories.AuditRepo
+	userRepo  *repositories.UserRepo
+	access    *PolicyService
+	formTypes *FormTypeService
+}
+
+func NewSubmissionService(subRepo *repositories.SubmissionRepo, formRepo *repositories.FormRepo, userRepo *repositories.UserRepo, access *PolicyService, formTypes *FormTypeService) *SubmissionService {
+	return &SubmissionService{subRepo: subRepo, formRepo: formRepo, userRepo: userRepo, access: access, formTypes: formTypes}
 }
 
-func NewSubmissionService(subRepo *repositories.SubmissionRepo, formRepo *repositories.FormRepo, auditRepo *repositories.AuditRepo) *SubmissionService {
-	return &SubmissionService{subRepo: subRepo, formRepo: formRepo, auditRepo: auditRepo}
+// organizationOf returns the organization a user acts for; submissions are
+// owned by organizations so colleagues can pick up each other's work.
+func (s *SubmissionService) organizationOf(userID uint) (uint, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.OrganizationID == nil {
+		return 0, ErrNoOrganization
+	}
+	return *user.OrganizationID, nil
+}
+
+// submitterOrganization is organizationOf for writes, which additionally
+// require a verified email.
+func (s *SubmissionService) submitterOrganization(userID uint) (uint, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if !user.EmailVerified() {
+		return 0, ErrEmailNotVerified
+	}
+	if user.OrganizationID == nil {
+		return 0, ErrNoOrganization
+	}
+	return *user.OrganizationID, nil
+}
+
+// currentVersion is the published version new data is validated against;
+// drafts and versions scheduled for later are never used.
+func (s *SubmissionService) currentVersion(formType models.FormType) (*models.FormVersion, error) {
+	template, err := s.formRepo.Current(formType, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoPublishedVersion
+	}
+	return template, err
 }
 
-func (s *SubmissionService) Submit(formType models.FormType, userID uint, dataStr string, isDraft bool) (*models.Submission, error) {
-	template, err := s.formRepo.GetLatest(formType)
+// Submit creates a submission. entry, when set, is its audit entry, stored
+// with it.
+func (s *SubmissionService) Submit(formType models.FormType, userID uint, role models.Role, dataStr string, isDraft bool, entry *models.AuditLog) (*models.Submission, error) {
+	if _, err := s.formTypes.ForSubmission(formType, role); err != nil {
+		return nil, err
+	}
+	orgID, err := s.submitterOrganization(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	validatedData, err := utils.ValidateData(template.Schema, dataStr, formType)
+	template, err := s.currentVersion(formType)
+	if err != nil {
+		return nil, err
+	}
+
+	validatedData, err := utils.ValidateData(template, dataStr)
 	if err != nil {
 		return nil, err
 	}
@@ -38,55 +98,147 @@ func (s *SubmissionService) Submit(formType models.FormType, userID uint, dataSt
 	}
 
 	sub := &models.Submission{
-		FormType:  formType,
-		Version:   template.Version,
-		UserID:    userID,
-		Data:      validatedData,
-		Status:    status,
-		CreatedBy: userID,
-		UpdatedBy: userID,
+		FormType:       formType,
+		Version:        template.Version,
+		UserID:         userID,
+		OrganizationID: orgID,
+		Data:           validatedData,
+		Status:         status,
+		CreatedBy:      userID,
+		UpdatedBy:      userID,
 	}
 
-	if err := s.subRepo.Create(sub); err != nil {
+	if err := s.subRepo.SaveAudited(sub, entry); err != nil {
 		return nil, err
 	}
 
 	return sub, nil
 }
 
-func (s *SubmissionService) UpdateDraft(id uint, userID uint, dataStr string) (*models.Submission, error) {
+// ownDraft loads a draft the user's organization may edit.
+func (s *SubmissionService) ownDraft(id uint, userID uint, role models.Role) (*models.Submission, error) {
+	orgID, err := s.submitterOrganization(userID)
+	if err != nil {
+		return nil, err
+	}
 	sub, err := s.subRepo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if sub.UserID != userID || sub.Status != models.Draft {
+	if sub.OrganizationID != orgID || sub.Status != models.Draft {
 		return nil, errors.New("unauthorized or invalid status")
 	}
+	if _, err := s.formTypes.ForSubmission(sub.FormType, role); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// pinnedVersion is the version a pinned draft keeps validating against.
+func (s *SubmissionService) pinnedVersion(sub *models.Submission) (*models.FormVersion, error) {
+	template, err := s.formRepo.FindVersion(sub.FormType, sub.Version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFormVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if template.Status == models.FormVersionRetired {
+		return nil, ErrPinnedRetired
+	}
+	return template, nil
+}
 
-	template, err := s.formRepo.GetLatest(sub.FormType)
+// UpdateDraft replaces a draft's data. Drafts validate against the current
+// version and move to it, unless they are pinned to their own. dataVersion
+// is the version the data was written for, 0 meaning the one the draft is
+// saved on; an unpinned draft may also send data for its own older version,
+// which is migrated first. entry is stored with the change.
+func (s *SubmissionService) UpdateDraft(id uint, userID uint, role models.Role, dataStr string, dataVersion int, entry *models.AuditLog) (*models.Submission, error) {
+	sub, err := s.ownDraft(id, userID, role)
 	if err != nil {
 		return nil, err
 	}
 
-	validatedData, err := utils.ValidateData(template.Schema, dataStr, sub.FormType)
+	var template *models.FormVersion
+	if sub.Pinned {
+		template, err = s.pinnedVersion(sub)
+	} else {
+		template, err = s.currentVersion(sub.FormType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	validatedData, err := editedData(sub, template, dataVersion, dataStr, s.formRepo.MigrationSteps)
 	if err != nil {
 		return nil, err
 	}
 
 	sub.Data = validatedData
+	sub.Version = template.Version
 	sub.UpdatedBy = userID
-	if err := s.subRepo.Update(sub); err != nil {
+	if err := s.subRepo.SaveAudited(sub, entry); err != nil {
 		return nil, err
 	}
 
 	return sub, nil
 }
 
-func (s *SubmissionService) Review(id uint, userID uint, newStatus models.Status, remarks string) error {
+// editedData validates an edit to a draft that will be saved on template.
+// Data written for the draft's own older version goes through the mappings
+// of every version since, as a migration would take it; data for template
+// is validated as it is, so mappings never run twice.
+func editedData(sub *models.Submission, template *models.FormVersion, dataVersion int, dataStr string,
+	migrationSteps func(formType models.FormType, after int, upTo int) ([]*models.FormVersion, error)) (string, error) {
+	switch {
+	case dataVersion == 0 || dataVersion == template.Version:
+		return utils.ValidateData(template, dataStr)
+	case dataVersion == sub.Version && sub.Version < template.Version:
+		steps, err := migrationSteps(sub.FormType, sub.Version, template.Version)
+		if err != nil {
+			return "", err
+		}
+		data, _, err := utils.MigrateData(steps, dataStr)
+		return data, err
+	default:
+		return "", ErrDataVersion
+	}
+}
+
+// SetPinned pins a draft to its version, so edits keep validating against
+// it and migrations pass it by, or unpins it. entry is stored with the
+// change; when pinning, its remarks name the version.
+func (s *SubmissionService) SetPinned(id uint, userID uint, role models.Role, pinned bool, entry *models.AuditLog) (*models.Submission, error) {
+	sub, err := s.ownDraft(id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if pinned && !sub.Pinned {
+		if _, err := s.pinnedVersion(sub); err != nil {
+			return nil, err
+		}
+	}
+	sub.Pinned = pinned
+	sub.UpdatedBy = userID
+	if pinned {
+		entry.Remarks = fmt.Sprintf("Pinned to version %d", sub.Version)
+	}
+	if err := s.subRepo.SaveAudited(sub, entry); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Review moves a submission to newStatus and stores entry with the change.
+func (s *SubmissionService) Review(id uint, userID uint, role models.Role, newStatus models.Status, entry *models.AuditLog) error {
 	sub, err := s.subRepo.FindByID(id)
 	if err != nil {
 		return err
 	}
+	if err := s.formTypes.CheckReviewer(sub.FormType, role); err != nil {
+		return err
+	}
 
 	validTransitions := map[models.Status][]models.Status{
 		models.Submitted: {models.InReview, models.Approved, models.Rejected},
@@ -99,17 +251,7 @@ func (s *SubmissionService) Review(id uint, userID uint, newStatus models.Status
 
 	sub.Status = newStatus
 	sub.UpdatedBy = userID
-	if err := s.subRepo.Update(sub); err != nil {
-		return err
-	}
-
-	audit := &models.AuditLog{
-		SubmissionID: sub.ID,
-		UserID:       userID,
-		Action:       fmt.Sprintf("Status changed to %s", newStatus),
-		Remarks:      remarks,
-	}
-	return s.auditRepo.Create(audit)
+	return s.subRepo.SaveAudited(sub, entry)
 }
 
 func containsStatus(statuses []models.Status, target models.Status) bool {
@@ -121,7 +263,7 @@ func containsStatus(statuses []models.Status, target models.Status) bool {
 	return false
 }
 
-func (s *SubmissionService) GetFiltered(userID uint, role models.Role, customerID *uint, status *string, startDateStr *string, endDateStr *string, limitStr string, offsetStr string) ([]models.Submission, error) {
+func (s *SubmissionService) GetFiltered(userID uint, role models.Role, customerID *uint, organizationID *uint, status *string, startDateStr *string, endDateStr *string, limitStr string, offsetStr string) ([]models.Submission, error) {
 	limit, _ := strconv.Atoi(limitStr)
 	if limit == 0 {
 		limit = 10
@@ -138,7 +280,18 @@ func (s *SubmissionService) GetFiltered(userID uint, role models.Role, customerI
 		endDate = &t
 	}
 
-	return s.subRepo.FindFiltered(userID, role, customerID, status, startDate, endDate, limit, offset)
+	// Without read_all the caller only ever sees their own organization,
+	// whatever filters they passed.
+	if !s.access.Can(role, models.PermSubmissionReadAll) {
+		orgID, err := s.organizationOf(userID)
+		if err != nil {
+			return nil, err
+		}
+		customerID = nil
+		organizationID = &orgID
+	}
+
+	return s.subRepo.FindFiltered(customerID, organizationID, status, startDate, endDate, limit, offset)
 }
 
 func (s *SubmissionService) GetByID(id uint, userID uint, role models.Role) (*models.Submission, error) {
@@ -146,8 +299,11 @@ func (s *SubmissionService) GetByID(id uint, userID uint, role models.Role) (*mo
 	if err != nil {
 		return nil, err
 	}
-	if role != models.Admin && sub.UserID != userID {
-		return nil, errors.New("unauthorized")
+	if !s.access.Can(role, models.PermSubmissionReadAll) {
+		orgID, err := s.organizationOf(userID)
+		if err != nil || sub.OrganizationID != orgID {
+			return nil, errors.New("unauthorized")
+		}
 	}
 	return sub, nil
 }
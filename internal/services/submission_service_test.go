@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"rcs-onboarding/internal/models"
+	"rcs-onboarding/internal/utils"
+)
+
+func TestEditedData(t *testing.T) {
+	// v2 renames zip and prefixes code, which must not happen twice.
+	schema, _ := json.Marshal([]models.Field{
+		{Name: "zip_code", Type: "string", Required: true},
+		{Name: "code", Type: "string"},
+	})
+	mappings, _ := json.Marshal([]models.FieldMapping{
+		{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		{Op: models.MappingTransform, Field: "code", Expr: `"RCS-" + code`},
+	})
+	current := &models.FormVersion{Type: models.Qualification, Version: 2, Schema: string(schema), Mappings: string(mappings)}
+	draft := &models.Submission{FormType: models.Qualification, Version: 1, Status: models.Draft}
+	steps := func(formType models.FormType, after int, upTo int) ([]*models.FormVersion, error) {
+		if formType != draft.FormType || after != 1 || upTo != 2 {
+			t.Fatalf("MigrationSteps(%s, %d, %d)", formType, after, upTo)
+		}
+		return []*models.FormVersion{current}, nil
+	}
+
+	tests := []struct {
+		name        string
+		dataVersion int
+		data        string
+		want        string
+		invalid     bool
+		err         error
+	}{
+		{name: "new shape", data: `{"zip_code": "12345", "code": "RCS-7"}`, want: `{"code":"RCS-7","zip_code":"12345"}`},
+		{name: "new shape, version given", dataVersion: 2, data: `{"zip_code": "12345", "code": "RCS-7"}`, want: `{"code":"RCS-7","zip_code":"12345"}`},
+		{name: "old shape", dataVersion: 1, data: `{"zip": "12345", "code": "7"}`, want: `{"code":"RCS-7","zip_code":"12345"}`},
+		{name: "old shape sent as new", data: `{"zip": "12345", "code": "7"}`, invalid: true},
+		{name: "unrelated version", dataVersion: 3, data: `{"zip_code": "12345"}`, err: ErrDataVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editedData(draft, current, tt.dataVersion, tt.data, steps)
+			var invalid *utils.ValidationError
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+			case tt.invalid:
+				if !errors.As(err, &invalid) {
+					t.Fatalf("error = %v, want a validation error", err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case got != tt.want:
+				t.Errorf("data = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditedDataPinned(t *testing.T) {
+	schema, _ := json.Marshal([]models.Field{{Name: "zip", Type: "string", Required: true}})
+	pinned := &models.FormVersion{Type: models.Qualification, Version: 1, Schema: string(schema)}
+	draft := &models.Submission{FormType: models.Qualification, Version: 1, Status: models.Draft, Pinned: true}
+	noSteps := func(models.FormType, int, int) ([]*models.FormVersion, error) {
+		t.Fatal("a pinned draft is never migrated")
+		return nil, nil
+	}
+	for _, dataVersion := range []int{0, 1} {
+		got, err := editedData(draft, pinned, dataVersion, `{"zip": "12345"}`, noSteps)
+		if err != nil || got != `{"zip":"12345"}` {
+			t.Errorf("version %d: data = %s, %v", dataVersion, got, err)
+		}
+	}
+	if _, err := editedData(draft, pinned, 2, `{"zip": "12345"}`, noSteps); !errors.Is(err, ErrDataVersion) {
+		t.Errorf("error = %v, want ErrDataVersion", err)
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rcs-onboarding/internal/models"
+)
+
+// fieldState is what a field's conditions decide for one submission.
+type fieldState struct {
+	hidden    bool
+	required  bool
+	forbidden bool
+}
+
+// evalFieldState evaluates a field's conditions against the object that
+// holds it.
+func evalFieldState(f models.Field, data map[string]interface{}) fieldState {
+	st := fieldState{required: f.Required}
+	if f.VisibleIf != nil && !evalCondition(*f.VisibleIf, data) {
+		st.hidden = true
+		st.required = false
+		return st
+	}
+	if f.RequiredIf != nil && evalCondition(*f.RequiredIf, data) {
+		st.required = true
+	}
+	if f.ForbiddenIf != nil && evalCondition(*f.ForbiddenIf, data) {
+		st.forbidden = true
+		st.required = false
+	}
+	return st
+}
+
+func evalCondition(c models.Condition, data map[string]interface{}) bool {
+	val, ok := lookupValue(data, c.Field)
+	switch {
+	case c.Present != nil:
+		return ok == *c.Present
+	case c.Equals != nil:
+		return ok && sameValue(val, c.Equals)
+	case c.NotEquals != nil:
+		return !ok || !sameValue(val, c.NotEquals)
+	case c.In != nil:
+		return ok && anyValue(val, c.In)
+	case c.NotIn != nil:
+		return !ok || !anyValue(val, c.NotIn)
+	}
+	return false
+}
+
+// lookupValue follows a dotted path through nested objects. A null value
+// counts as missing.
+func lookupValue(data map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func anyValue(val interface{}, candidates []interface{}) bool {
+	for _, c := range candidates {
+		if sameValue(val, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue compares a submitted value with one from a schema. Submitted
+// numbers arrive as json.Number and schema numbers as float64, so both sides
+// are reduced to text first.
+func sameValue(a, b interface{}) bool {
+	return strings.EqualFold(conditionText(a), conditionText(b))
+}
+
+func conditionText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		if n, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func schemaHasPath(fields []models.Field, path string) bool {
+	name, rest, nested := strings.Cut(path, ".")
+	for _, f := range fields {
+		if f.Name != name {
+			continue
+		}
+		if !nested {
+			return true
+		}
+		return f.Type == "object" && schemaHasPath(f.Fields, rest)
+	}
+	return false
+}
@@ -0,0 +1,764 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Rule expressions are a small, side-effect free language over submitted
+// values: field paths (brand_name, address.country), string, number, true,
+// false and null literals, the operators || && ! == != < <= > >= + - * / %
+// and a fixed set of functions. There are no loops, assignments or access to
+// anything but the submission, and evaluation is bounded by a step budget
+// and a deadline.
+
+const (
+	maxExprLength    = 2000
+	maxExprDepth     = 50
+	maxExprSteps     = 100000
+	maxExprStringLen = 10000
+)
+
+var (
+	errExprTimeout = errors.New("evaluation timed out")
+	errExprBudget  = errors.New("evaluation step limit exceeded")
+
+	// Parsed rule expressions, shared across requests.
+	exprCache sync.Map
+)
+
+type exprEnv struct {
+	data     map[string]interface{}
+	deadline time.Time
+	steps    int
+}
+
+func (env *exprEnv) step() error {
+	env.steps++
+	if env.steps > maxExprSteps {
+		return errExprBudget
+	}
+	if env.steps%64 == 0 && time.Now().After(env.deadline) {
+		return errExprTimeout
+	}
+	return nil
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+// compiledExpr is a parsed expression and the field paths it reads.
+type compiledExpr struct {
+	root   exprNode
+	fields []string
+}
+
+// compileExpr parses an expression, reusing earlier parses of the same text.
+func compileExpr(src string) (*compiledExpr, error) {
+	if e, ok := exprCache.Load(src); ok {
+		return e.(*compiledExpr), nil
+	}
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExprLength)
+	}
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	e := &compiledExpr{root: root, fields: p.fields}
+	exprCache.Store(src, e)
+	return e, nil
+}
+
+// eval runs an expression against data.
+func (e *compiledExpr) eval(data map[string]interface{}, deadline time.Time) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("evaluation failed: %v", r)
+		}
+	}()
+	return e.root.eval(&exprEnv{data: data, deadline: deadline})
+}
+
+// evalBool runs an expression against data and requires a boolean result.
+func (e *compiledExpr) evalBool(data map[string]interface{}, deadline time.Time) (bool, error) {
+	v, err := e.eval(data, deadline)
+	if err != nil {
+		return false, err
+	}
+	b, isBool := v.(bool)
+	if !isBool {
+		return false, fmt.Errorf("expression must be true or false, got %s", exprTypeName(v))
+	}
+	return b, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func lexExpr(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i]) || (src[i] == '.' && i+1 < len(src) && isIdentStart(src[i+1]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", src[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: n, pos: start})
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Parser: precedence climbs from || through && , equality, comparison,
+// additive and multiplicative operators to unary operators and operands.
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	depth  int
+	fields []string
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > maxExprDepth {
+		return fmt.Errorf("expression is nested more than %d levels deep", maxExprDepth)
+	}
+	return nil
+}
+
+func (p *exprParser) parseBinary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseEquality, "&&")
+}
+
+func (p *exprParser) parseEquality() (exprNode, error) {
+	return p.parseBinary(p.parseComparison, "==", "!=")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.parseBinary(p.parseAdditive, "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{v: t.num}, nil
+	case tokString:
+		return &literalNode{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		case "null":
+			return &literalNode{v: nil}, nil
+		}
+		if _, ok := p.acceptOp("("); ok {
+			return p.parseCall(t)
+		}
+		p.fields = append(p.fields, t.text)
+		return &fieldNode{path: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.acceptOp(")"); !ok {
+				return nil, fmt.Errorf("missing ) at position %d", p.peek().pos)
+			}
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at position %d", name.text, name.pos)
+	}
+	var args []exprNode
+	if _, ok := p.acceptOp(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.acceptOp(","); ok {
+				continue
+			}
+			if _, ok := p.acceptOp(")"); !ok {
+				return nil, fmt.Errorf("missing ) after arguments of %s", name.text)
+			}
+			break
+		}
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name.text)
+	}
+
+	// Patterns are compiled once, here, so a rule cannot build them from
+	// submitted data.
+	if name.text == "matches" {
+		var pattern string
+		lit, ok := args[1].(*literalNode)
+		if ok {
+			pattern, ok = lit.v.(string)
+		}
+		if !ok {
+			return nil, fmt.Errorf("matches needs a literal pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("matches: %v", err)
+		}
+		return &matchNode{x: args[0], re: re}, nil
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// Nodes
+
+type literalNode struct{ v interface{} }
+
+func (n *literalNode) eval(env *exprEnv) (interface{}, error) {
+	return n.v, env.step()
+}
+
+type fieldNode struct{ path string }
+
+func (n *fieldNode) eval(env *exprEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	v, _ := lookupValue(env.data, n.path)
+	if num, ok := v.(json.Number); ok {
+		f, err := num.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a usable number", n.path)
+		}
+		return f, nil
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n *unaryNode) eval(env *exprEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! needs true or false, got %s", exprTypeName(v))
+		}
+		return !b, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- needs a number, got %s", exprTypeName(v))
+	}
+	return -f, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs true or false, got %s", n.op, exprTypeName(l))
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs true or false, got %s", n.op, exprTypeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return exprEqual(l, r), nil
+	case "!=":
+		return !exprEqual(l, r), nil
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply %s to %s and %s", n.op, exprTypeName(l), exprTypeName(r))
+		}
+		switch n.op {
+		case "+":
+			if len(ls)+len(rs) > maxExprStringLen {
+				return nil, fmt.Errorf("string result longer than %d bytes", maxExprStringLen)
+			}
+			return ls + rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+		return nil, fmt.Errorf("cannot apply %s to strings", n.op)
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", n.op, exprTypeName(l), exprTypeName(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/", "%":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if n.op == "/" {
+			return lf / rf, nil
+		}
+		return math.Mod(lf, rf), nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type matchNode struct {
+	x  exprNode
+	re *regexp.Regexp
+}
+
+func (n *matchNode) eval(env *exprEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	s, err := exprString("matches", v)
+	if err != nil {
+		return nil, err
+	}
+	return n.re.MatchString(s), nil
+}
+
+type exprFunc struct {
+	minArgs, maxArgs int // maxArgs -1 = any
+	call             func(args []interface{}) (interface{}, error)
+}
+
+type callNode struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n *callNode) eval(env *exprEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.name, err)
+	}
+	return v, nil
+}
+
+// Functions. String functions treat null (a missing value) as "".
+var exprFuncs map[string]exprFunc
+
+func init() {
+	stringFunc := func(name string, f func(string) interface{}) exprFunc {
+		return exprFunc{1, 1, func(args []interface{}) (interface{}, error) {
+			s, err := exprString(name, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return f(s), nil
+		}}
+	}
+	stringPairFunc := func(name string, f func(string, string) bool) exprFunc {
+		return exprFunc{2, 2, func(args []interface{}) (interface{}, error) {
+			a, err := exprString(name, args[0])
+			if err != nil {
+				return nil, err
+			}
+			b, err := exprString(name, args[1])
+			if err != nil {
+				return nil, err
+			}
+			return f(a, b), nil
+		}}
+	}
+	numberFold := func(pick func(a, b float64) float64) exprFunc {
+		return exprFunc{1, -1, func(args []interface{}) (interface{}, error) {
+			var out float64
+			for i, a := range args {
+				f, ok := a.(float64)
+				if !ok {
+					return nil, fmt.Errorf("needs numbers, got %s", exprTypeName(a))
+				}
+				if i == 0 {
+					out = f
+				} else {
+					out = pick(out, f)
+				}
+			}
+			return out, nil
+		}}
+	}
+
+	exprFuncs = map[string]exprFunc{
+		"len": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case nil:
+				return float64(0), nil
+			case string:
+				return float64(utf8.RuneCountInString(v)), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case map[string]interface{}:
+				return float64(len(v)), nil
+			}
+			return nil, fmt.Errorf("needs a string or list, got %s", exprTypeName(args[0]))
+		}},
+		"lower":       stringFunc("lower", func(s string) interface{} { return strings.ToLower(s) }),
+		"upper":       stringFunc("upper", func(s string) interface{} { return strings.ToUpper(s) }),
+		"trim":        stringFunc("trim", func(s string) interface{} { return strings.TrimSpace(s) }),
+		"starts_with": stringPairFunc("starts_with", strings.HasPrefix),
+		"ends_with":   stringPairFunc("ends_with", strings.HasSuffix),
+		"contains": {2, 2, func(args []interface{}) (interface{}, error) {
+			if list, ok := args[0].([]interface{}); ok {
+				for _, item := range list {
+					if exprEqual(item, args[1]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			a, err := exprString("contains", args[0])
+			if err != nil {
+				return nil, err
+			}
+			b, err := exprString("contains", args[1])
+			if err != nil {
+				return nil, err
+			}
+			return strings.Contains(a, b), nil
+		}},
+		"matches": {2, 2, nil}, // compiled into a matchNode by the parser
+		"number": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case float64:
+				return v, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%q is not a number", v)
+				}
+				return f, nil
+			}
+			return nil, fmt.Errorf("needs a string or number, got %s", exprTypeName(args[0]))
+		}},
+		"abs": {1, 1, func(args []interface{}) (interface{}, error) {
+			f, ok := args[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("needs a number, got %s", exprTypeName(args[0]))
+			}
+			return math.Abs(f), nil
+		}},
+		"min": numberFold(math.Min),
+		"max": numberFold(math.Max),
+	}
+}
+
+func exprString(fn string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("%s needs a string, got %s", fn, exprTypeName(v))
+}
+
+// exprEqual compares values of the same type; values of different types are
+// never equal.
+func exprEqual(a, b interface{}) bool {
+	a, b = exprNumber(a), exprNumber(b)
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bb, ok := b.(bool)
+		return ok && a == bb
+	case float64:
+		bf, ok := b.(float64)
+		return ok && a == bf
+	case string:
+		bs, ok := b.(string)
+		return ok && a == bs
+	}
+	return false
+}
+
+// exprNumber turns a json.Number from inside a submitted list or object into
+// a float64 so it compares like a top-level value.
+func exprNumber(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func exprTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeData decodes submission JSON the way ValidateData does, with numbers
+// as json.Number.
+func decodeData(t *testing.T, src string) map[string]interface{} {
+	t.Helper()
+	var data map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type exprCase struct {
+	name string
+	expr string
+	data string
+	want interface{}
+	err  string // substring of the expected error; empty when none
+}
+
+func runExprCases(t *testing.T, tests []exprCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{}
+			if tt.data != "" {
+				data = decodeData(t, tt.data)
+			}
+			e, err := compileExpr(tt.expr)
+			var got interface{}
+			if err == nil {
+				got, err = e.eval(data, time.Now().Add(time.Second))
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("%s: error = %v, want one containing %q", tt.expr, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprPrecedence(t *testing.T) {
+	runExprCases(t, []exprCase{
+		{name: "multiplication before addition", expr: "1 + 2 * 3", want: 7.0},
+		{name: "parentheses", expr: "(1 + 2) * 3", want: 9.0},
+		{name: "subtraction is left associative", expr: "10 - 4 - 3", want: 3.0},
+		{name: "division is left associative", expr: "8 / 4 / 2", want: 1.0},
+		{name: "modulo binds like multiplication", expr: "1 + 7 % 4", want: 4.0},
+		{name: "unary minus binds tightest", expr: "-2 * 3", want: -6.0},
+		{name: "arithmetic before comparison", expr: "1 + 1 < 3", want: true},
+		{name: "comparison before equality", expr: "1 < 2 == true", want: true},
+		{name: "equality before and", expr: "1 == 1 && 2 == 2", want: true},
+		{name: "and before or", expr: "true || false && false", want: true},
+		{name: "and before or, left side", expr: "false && false || true", want: true},
+		{name: "not binds before and", expr: "!false && false", want: false},
+		{name: "not of a group", expr: "!(false || true)", want: false},
+		{name: "string concatenation", expr: `"a" + "b" == "ab"`, want: true},
+	})
+}
+
+func TestExprShortCircuit(t *testing.T) {
+	runExprCases(t, []exprCase{
+		{name: "false and skips the right side", expr: "false && 1 / 0 == 1", want: false},
+		{name: "true or skips the right side", expr: "true || 1 / 0 == 1", want: true},
+		{name: "true and evaluates the right side", expr: "true && 1 / 0 == 1", err: "division by zero"},
+		{name: "false or evaluates the right side", expr: "false || 1 / 0 == 1", err: "division by zero"},
+		{name: "skipped side may have the wrong type", expr: `false && "text"`, want: false},
+		{name: "evaluated side must be boolean", expr: `true && "text"`, err: "&& needs true or false, got string"},
+		{name: "left side must be boolean", expr: "1 || true", err: "|| needs true or false, got number"},
+		{name: "guard a missing field", expr: "amount == null || amount > 0", want: true},
+	})
+}
+
+func TestExprNullAndMissing(t *testing.T) {
+	data := `{"name": "Acme", "empty": null, "count": 3, "address": {"country": "DE"}, "tags": ["a", 2]}`
+	tests := []exprCase{
+		{name: "missing equals null", expr: "missing == null", want: true},
+		{name: "explicit null equals null", expr: "empty == null", want: true},
+		{name: "present is not null", expr: "name != null", want: true},
+		{name: "missing nested path is null", expr: "address.city == null", want: true},
+		{name: "path through a non-object is null", expr: "name.first == null", want: true},
+		{name: "nested value", expr: `address.country == "DE"`, want: true},
+		{name: "null is not false", expr: "missing == false", want: false},
+		{name: "null is not zero", expr: "missing == 0", want: false},
+		{name: "null is not empty string", expr: `missing == ""`, want: false},
+		{name: "values of different types differ", expr: `count == "3"`, want: false},
+		{name: "submitted numbers are numbers", expr: "count + 1", want: 4.0},
+		{name: "numbers inside lists compare as numbers", expr: "contains(tags, 2)", want: true},
+		{name: "len of missing is zero", expr: "len(missing)", want: 0.0},
+		{name: "string functions read missing as empty", expr: `lower(missing) == ""`, want: true},
+		{name: "comparing missing fails", expr: "missing > 1", err: "cannot apply > to null and number"},
+		{name: "arithmetic on missing fails", expr: "missing + 1", err: "cannot apply + to null and number"},
+		{name: "negating missing fails", expr: "!missing", err: "! needs true or false, got null"},
+	}
+	for i := range tests {
+		tests[i].data = data
+	}
+	runExprCases(t, tests)
+}
+
+func TestExprMatches(t *testing.T) {
+	runExprCases(t, []exprCase{
+		{name: "literal pattern", expr: `matches(code, "^[A-Z]{3}$")`, data: `{"code": "ABC"}`, want: true},
+		{name: "literal pattern, no match", expr: `matches(code, "^[A-Z]{3}$")`, data: `{"code": "AB1"}`, want: false},
+		{name: "missing value matches as empty", expr: `matches(code, "^$")`, want: true},
+		{name: "pattern from a field", expr: `matches(code, pattern)`, err: "matches needs a literal pattern"},
+		{name: "pattern from an expression", expr: `matches(code, "^" + "a")`, err: "matches needs a literal pattern"},
+		{name: "pattern from a function", expr: `matches(code, lower("A"))`, err: "matches needs a literal pattern"},
+		{name: "invalid pattern", expr: `matches(code, "(")`, err: "matches:"},
+		{name: "non-string value", expr: `matches(code, "^1$")`, data: `{"code": 1}`, err: "matches needs a string, got number"},
+	})
+}
+
+func TestExprDepthLimit(t *testing.T) {
+	// The top level counts as one level; each group or unary operator adds one.
+	nested := func(n int) string {
+		return strings.Repeat("(", n) + "true" + strings.Repeat(")", n)
+	}
+	tests := []struct {
+		name string
+		expr string
+		ok   bool
+	}{
+		{"groups at the limit", nested(maxExprDepth - 1), true},
+		{"groups over the limit", nested(maxExprDepth), false},
+		{"nots at the limit", strings.Repeat("!", maxExprDepth-1) + "true", true},
+		{"nots over the limit", strings.Repeat("!", maxExprDepth) + "true", false},
+		{"function arguments count", "len(" + nested(maxExprDepth-1) + ")", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileExpr(tt.expr)
+			if tt.ok && err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "nested more than")) {
+				t.Fatalf("compile error = %v, want depth limit", err)
+			}
+		})
+	}
+}
+
+func TestExprLengthLimit(t *testing.T) {
+	long := strings.Repeat("1 + ", maxExprLength/4) + "1"
+	if _, err := compileExpr(long); err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Fatalf("compile error = %v, want length limit", err)
+	}
+}
+
+func TestExprStepLimit(t *testing.T) {
+	e, err := compileExpr("1 + 2") // three steps
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		steps int
+		err   error
+	}{
+		{"within budget", maxExprSteps - 3, nil},
+		{"over budget", maxExprSteps - 2, errExprBudget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &exprEnv{deadline: time.Now().Add(time.Second), steps: tt.steps}
+			if _, err := e.root.eval(env); !errors.Is(err, tt.err) {
+				t.Fatalf("eval error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExprDeadline(t *testing.T) {
+	// The clock is checked every 64 steps, so a short expression can finish
+	// past its deadline but a longer one cannot.
+	tests := []struct {
+		name  string
+		terms int
+		err   error
+	}{
+		{"short expression", 2, nil},
+		{"long expression", 100, errExprTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := compileExpr(strings.Repeat("1 + ", tt.terms-1) + "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := e.eval(nil, time.Now().Add(-time.Second)); !errors.Is(err, tt.err) {
+				t.Fatalf("eval error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExprEvalBoolRequiresBoolean(t *testing.T) {
+	e, err := compileExpr("1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.evalBool(nil, time.Now().Add(time.Second)); err == nil || !strings.Contains(err.Error(), "must be true or false") {
+		t.Fatalf("evalBool error = %v, want a type error", err)
+	}
+}
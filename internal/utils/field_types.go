@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	phoneRegex   = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	colorRegex   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	decimalRegex = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+)
+
+// parseDate reads a date (YYYY-MM-DD) or, when allowed, an RFC 3339 timestamp.
+func parseDate(s string, allowDateTime bool) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+	if allowDateTime {
+		return time.Parse(time.RFC3339, s)
+	}
+	return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date", s)
+}
+
+func validateDate(f models.Field, path string, val interface{}, errs *fieldErrors) {
+	s, ok := val.(string)
+	if !ok {
+		errs.add(path, CodeInvalidType, expect("string"), "%s must be string", path)
+		return
+	}
+	var t time.Time
+	var err error
+	if f.Type == "date" {
+		if t, err = time.Parse(dateLayout, s); err != nil {
+			errs.add(path, CodeInvalidDate, map[string]interface{}{"format": "YYYY-MM-DD"}, "%s must be a date like 2024-12-31", path)
+			return
+		}
+	} else if t, err = time.Parse(time.RFC3339, s); err != nil {
+		errs.add(path, CodeInvalidDate, map[string]interface{}{"format": "RFC 3339"}, "%s must be an RFC 3339 date-time like 2024-12-31T09:00:00Z", path)
+		return
+	}
+
+	if f.MinDate != "" {
+		if min, err := parseDate(f.MinDate, true); err == nil && t.Before(min) {
+			errs.add(path, CodeDateTooEarly, map[string]interface{}{"limit": f.MinDate}, "%s must not be before %s", path, f.MinDate)
+			return
+		}
+	}
+	if f.MaxDate != "" {
+		if max, err := parseDate(f.MaxDate, true); err == nil && t.After(max) {
+			errs.add(path, CodeDateTooLate, map[string]interface{}{"limit": f.MaxDate}, "%s must not be after %s", path, f.MaxDate)
+		}
+	}
+}
+
+// validateDecimal accepts a JSON number or a numeric string, so amounts can
+// be sent without float rounding.
+func validateDecimal(f models.Field, path string, val interface{}, errs *fieldErrors) {
+	var s string
+	switch v := val.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if !decimalRegex.MatchString(s) || err != nil {
+		errs.add(path, CodeInvalidDecimal, nil, "%s must be a decimal number", path)
+		return
+	}
+	if f.Precision > 0 {
+		if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > f.Precision {
+			errs.add(path, CodePrecision, limit(f.Precision), "%s allows at most %d decimal places", path, f.Precision)
+			return
+		}
+	}
+	if f.Min > 0 && n < float64(f.Min) {
+		errs.add(path, CodeMin, limit(f.Min), "%s below min %d", path, f.Min)
+	} else if f.Max > 0 && n > float64(f.Max) {
+		errs.add(path, CodeMax, limit(f.Max), "%s exceeds max %d", path, f.Max)
+	}
+}
+
+func validateMultiLookup(f models.Field, path string, val interface{}, errs *fieldErrors) {
+	items, ok := val.([]interface{})
+	if !ok {
+		errs.add(path, CodeInvalidType, expect("list"), "%s must be a list of options", path)
+		return
+	}
+	if f.Min > 0 && len(items) < f.Min {
+		errs.add(path, CodeMinItems, limit(f.Min), "%s needs at least %d selections", path, f.Min)
+	} else if f.Max > 0 && len(items) > f.Max {
+		errs.add(path, CodeMaxItems, limit(f.Max), "%s allows at most %d selections", path, f.Max)
+	}
+	seen := map[string]bool{}
+	for i, item := range items {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		s, ok := item.(string)
+		if !ok {
+			errs.add(itemPath, CodeInvalidType, expect("string"), "%s must be string", itemPath)
+			continue
+		}
+		if !contains(f.Options, s) {
+			errs.add(itemPath, CodeInvalidOption, map[string]interface{}{"value": s, "options": f.Options}, "%s invalid option: %s", path, s)
+			continue
+		}
+		if seen[strings.ToLower(s)] {
+			errs.add(itemPath, CodeDuplicateOption, map[string]interface{}{"value": s}, "%s lists %s more than once", path, s)
+		}
+		seen[strings.ToLower(s)] = true
+	}
+}
+
+func validateArray(f models.Field, path string, val interface{}, policy string, errs *fieldErrors) {
+	items, ok := val.([]interface{})
+	if !ok {
+		errs.add(path, CodeInvalidType, expect("list"), "%s must be a list", path)
+		return
+	}
+	if f.Min > 0 && len(items) < f.Min {
+		errs.add(path, CodeMinItems, limit(f.Min), "%s needs at least %d items", path, f.Min)
+	} else if f.Max > 0 && len(items) > f.Max {
+		errs.add(path, CodeMaxItems, limit(f.Max), "%s allows at most %d items", path, f.Max)
+	}
+	if f.Items == nil {
+		return
+	}
+	for i, item := range items {
+		validateField(*f.Items, fmt.Sprintf("%s[%d]", path, i), item, policy, errs)
+	}
+}
+
+// validateText applies the pattern and named format of a field to a string
+// value that already passed its type check.
+func validateText(f models.Field, path string, val interface{}, errs *fieldErrors) {
+	s, ok := val.(string)
+	if !ok {
+		return
+	}
+	if f.Pattern != "" {
+		re, err := compilePattern(f.Pattern)
+		if err == nil && !re.MatchString(s) {
+			errs.add(path, CodePatternMismatch, map[string]interface{}{"pattern": f.Pattern}, "%s does not match the required pattern", path)
+			return
+		}
+	}
+	if f.Format != "" {
+		if format, ok := lookupFormat(f.Format); ok && !format.check(s) {
+			errs.add(path, CodeInvalidFormat, map[string]interface{}{"format": f.Format}, "%s must be a valid %s", path, f.Format)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Format is a named check for string values that schemas can reference with
+// the "format" attribute instead of repeating a pattern.
+type Format struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	check       func(string) bool
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{}
+
+	// Compiled schema patterns, shared across requests.
+	patternCache sync.Map
+)
+
+func init() {
+	registerPattern("ein", "US employer identification number, e.g. 12-3456789", `^[0-9]{2}-[0-9]{7}$`)
+	registerPattern("upper_alnum", "Uppercase letters and digits only", `^[A-Z0-9]+$`)
+	registerPattern("digits", "Digits only", `^[0-9]+$`)
+	registerPattern("us_zip", "US ZIP or ZIP+4 code", `^[0-9]{5}(-[0-9]{4})?$`)
+	registerPattern("us_state", "Two-letter US state code", `^[A-Z]{2}$`)
+	registerPattern("slug", "Lowercase words joined by hyphens or underscores", `^[a-z0-9]+([-_][a-z0-9]+)*$`)
+	registerPattern("uuid", "UUID in canonical form", `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+}
+
+func registerPattern(name, description, pattern string) {
+	re := regexp.MustCompile(pattern)
+	RegisterFormat(name, description, re.MatchString)
+}
+
+// RegisterFormat adds or replaces a named format.
+func RegisterFormat(name string, description string, check func(string) bool) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[name] = Format{Name: name, Description: description, check: check}
+}
+
+func lookupFormat(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Formats lists the registered formats by name.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	list := make([]Format, 0, len(formats))
+	for _, f := range formats {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
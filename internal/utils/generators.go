@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	generatorsMu sync.RWMutex
+	generators   = map[string]func() string{}
+)
+
+func init() {
+	RegisterGenerator("sid", func() string {
+		return "HSN-" + strings.ToUpper(uuid.New().String()[:8])
+	})
+	RegisterGenerator("uuid", func() string {
+		return uuid.New().String()
+	})
+}
+
+// RegisterGenerator adds or replaces a named value generator that schema
+// fields can reference with the "generate" attribute.
+func RegisterGenerator(name string, generate func() string) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+	generators[name] = generate
+}
+
+func lookupGenerator(name string) (func() string, bool) {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+	g, ok := generators[name]
+	return g, ok
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+// MigrationChange records one field mapping that changed a draft's data.
+type MigrationChange struct {
+	Version int         `json:"version"` // the version the mapping belongs to
+	Op      string      `json:"op"`
+	Field   string      `json:"field"`
+	To      string      `json:"to,omitempty"`
+	Before  interface{} `json:"before"` // null when the value was missing
+	After   interface{} `json:"after"`  // null when the value was removed
+}
+
+// MigrateData moves draft data to a newer form version. steps are the
+// versions after the draft's own, in order and ending with the target; the
+// mappings of each run in turn and the result is validated against the
+// target. It returns the data to store and the changes made, which are also
+// returned alongside a *ValidationError when the migrated data is invalid.
+func MigrateData(steps []*models.FormVersion, dataStr string) (string, []MigrationChange, error) {
+	if len(steps) == 0 {
+		return "", nil, errors.New("no version to migrate to")
+	}
+	var data map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(dataStr))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil || data == nil {
+		return "", nil, &ValidationError{Errors: []FieldError{{Code: CodeInvalidJSON, Message: "data must be a JSON object"}}}
+	}
+
+	changes := []MigrationChange{}
+	var errs fieldErrors
+	deadline := time.Now().Add(ruleTimeout)
+	for _, step := range steps {
+		mappings, err := step.DecodeMappings()
+		if err != nil {
+			return "", nil, err
+		}
+		for _, m := range mappings {
+			change, err := applyMapping(m, data, deadline)
+			if err != nil {
+				params := map[string]interface{}{"version": step.Version, "op": m.Op, "error": err.Error()}
+				errs.add(m.Field, CodeMigration, params, "%s could not be migrated to version %d: %v", m.Field, step.Version, err)
+				continue
+			}
+			if change != nil {
+				change.Version = step.Version
+				changes = append(changes, *change)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return "", changes, &ValidationError{Errors: errs}
+	}
+
+	mapped, err := json.Marshal(data)
+	if err != nil {
+		return "", nil, err
+	}
+	validated, err := ValidateData(steps[len(steps)-1], string(mapped))
+	if err != nil {
+		return "", changes, err
+	}
+	return validated, changes, nil
+}
+
+// applyMapping runs one mapping on data and describes what it changed, or
+// returns nil when there was nothing to do. A rename never overwrites a
+// value already at its target; the draft fails to migrate instead.
+func applyMapping(m models.FieldMapping, data map[string]interface{}, deadline time.Time) (*MigrationChange, error) {
+	change := &MigrationChange{Op: m.Op, Field: m.Field, To: m.To}
+	switch m.Op {
+	case models.MappingRename:
+		val, ok := takeValue(data, m.Field)
+		if !ok {
+			return nil, nil
+		}
+		if _, taken := lookupValue(data, m.To); taken {
+			if val != nil {
+				return nil, fmt.Errorf("%s already has a value", m.To)
+			}
+			return nil, nil
+		}
+		if err := setValue(data, m.To, val); err != nil {
+			return nil, err
+		}
+		change.Before, change.After = val, val
+	case models.MappingDefault:
+		if _, ok := lookupValue(data, m.Field); ok {
+			return nil, nil
+		}
+		if err := setValue(data, m.Field, m.Value); err != nil {
+			return nil, err
+		}
+		change.After = m.Value
+	case models.MappingDrop:
+		val, ok := takeValue(data, m.Field)
+		if !ok {
+			return nil, nil
+		}
+		change.Before = val
+	case models.MappingTransform:
+		expr, err := compileExpr(m.Expr)
+		if err != nil {
+			return nil, err
+		}
+		before, _ := lookupValue(data, m.Field)
+		after, err := expr.eval(data, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if exprEqual(before, after) {
+			return nil, nil
+		}
+		if after == nil {
+			takeValue(data, m.Field)
+		} else if err := setValue(data, m.Field, after); err != nil {
+			return nil, err
+		}
+		change.Before, change.After = before, after
+	default:
+		return nil, fmt.Errorf("unknown mapping op %q", m.Op)
+	}
+	return change, nil
+}
+
+// takeValue removes the value at a dotted path and returns it.
+func takeValue(data map[string]interface{}, path string) (interface{}, bool) {
+	obj, key := data, path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		v, _ := lookupValue(data, path[:i])
+		parent, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		obj, key = parent, path[i+1:]
+	}
+	val, ok := obj[key]
+	delete(obj, key)
+	return val, ok
+}
+
+// setValue stores a value at a dotted path, creating missing objects on the
+// way.
+func setValue(data map[string]interface{}, path string, val interface{}) error {
+	parts := strings.Split(path, ".")
+	obj := data
+	for i, part := range parts[:len(parts)-1] {
+		next, ok := obj[part]
+		if !ok || next == nil {
+			child := map[string]interface{}{}
+			obj[part] = child
+			obj = child
+			continue
+		}
+		if obj, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s is not an object", strings.Join(parts[:i+1], "."))
+		}
+	}
+	obj[parts[len(parts)-1]] = val
+	return nil
+}
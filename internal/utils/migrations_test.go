@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+// formVersion builds a version with the given fields and mappings.
+func formVersion(t *testing.T, version int, fields []models.Field, mappings ...models.FieldMapping) *models.FormVersion {
+	t.Helper()
+	schema, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappingsJSON, err := json.Marshal(mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.FormVersion{Version: version, Schema: string(schema), Mappings: string(mappingsJSON)}
+}
+
+// encode writes data as compact JSON with sorted keys.
+func encode(t *testing.T, data map[string]interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestApplyMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping models.FieldMapping
+		data    string
+		want    string // data afterwards
+		changed bool
+		err     string // substring of the expected error; empty when none
+	}{
+		{name: "rename", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "address.zip_code"},
+			data: `{"zip": "12345"}`, want: `{"address":{"zip_code":"12345"}}`, changed: true},
+		{name: "rename a missing value", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+			data: `{"name": "Acme"}`, want: `{"name":"Acme"}`},
+		{name: "rename onto an existing value", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+			data: `{"zip": "12345", "zip_code": "54321"}`, err: "zip_code already has a value"},
+		{name: "rename null onto an existing value", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+			data: `{"zip": null, "zip_code": "54321"}`, want: `{"zip_code":"54321"}`},
+		{name: "rename onto null", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+			data: `{"zip": "12345", "zip_code": null}`, want: `{"zip_code":"12345"}`, changed: true},
+		{name: "rename through a non-object", mapping: models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "name.zip"},
+			data: `{"zip": "12345", "name": "Acme"}`, err: "name is not an object"},
+		{name: "default a missing value", mapping: models.FieldMapping{Op: models.MappingDefault, Field: "country", Value: "DE"},
+			data: `{}`, want: `{"country":"DE"}`, changed: true},
+		{name: "default a null value", mapping: models.FieldMapping{Op: models.MappingDefault, Field: "country", Value: "DE"},
+			data: `{"country": null}`, want: `{"country":"DE"}`, changed: true},
+		{name: "default keeps a value", mapping: models.FieldMapping{Op: models.MappingDefault, Field: "country", Value: "DE"},
+			data: `{"country": "FR"}`, want: `{"country":"FR"}`},
+		{name: "drop", mapping: models.FieldMapping{Op: models.MappingDrop, Field: "address.fax"},
+			data: `{"address": {"fax": "1", "city": "Berlin"}}`, want: `{"address":{"city":"Berlin"}}`, changed: true},
+		{name: "drop a missing value", mapping: models.FieldMapping{Op: models.MappingDrop, Field: "fax"},
+			data: `{}`, want: `{}`},
+		{name: "transform", mapping: models.FieldMapping{Op: models.MappingTransform, Field: "code", Expr: "upper(code)"},
+			data: `{"code": "abc"}`, want: `{"code":"ABC"}`, changed: true},
+		{name: "transform to the same value", mapping: models.FieldMapping{Op: models.MappingTransform, Field: "code", Expr: "upper(code)"},
+			data: `{"code": "ABC"}`, want: `{"code":"ABC"}`},
+		{name: "transform returning null deletes the field", mapping: models.FieldMapping{Op: models.MappingTransform, Field: "code", Expr: "null"},
+			data: `{"code": "abc", "name": "Acme"}`, want: `{"name":"Acme"}`, changed: true},
+		{name: "transform error", mapping: models.FieldMapping{Op: models.MappingTransform, Field: "code", Expr: "code + 1"},
+			data: `{"code": "abc"}`, err: "cannot apply +"},
+		{name: "unknown op", mapping: models.FieldMapping{Op: "copy", Field: "code"},
+			data: `{}`, err: `unknown mapping op "copy"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := decodeData(t, tt.data)
+			change, err := applyMapping(tt.mapping, data, time.Now().Add(time.Second))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := encode(t, data); got != tt.want {
+				t.Errorf("data = %s, want %s", got, tt.want)
+			}
+			if (change != nil) != tt.changed {
+				t.Errorf("change = %+v, want changed %v", change, tt.changed)
+			}
+		})
+	}
+}
+
+func TestTakeValue(t *testing.T) {
+	tests := []struct {
+		path string
+		val  interface{}
+		ok   bool
+		rest string
+	}{
+		{"name", "Acme", true, `{"address":{"city":"Berlin"},"empty":null}`},
+		{"address.city", "Berlin", true, `{"address":{},"empty":null,"name":"Acme"}`},
+		{"empty", nil, true, `{"address":{"city":"Berlin"},"name":"Acme"}`},
+		{"missing", nil, false, `{"address":{"city":"Berlin"},"empty":null,"name":"Acme"}`},
+		{"name.first", nil, false, `{"address":{"city":"Berlin"},"empty":null,"name":"Acme"}`},
+		{"address.city.name", nil, false, `{"address":{"city":"Berlin"},"empty":null,"name":"Acme"}`},
+	}
+	for _, tt := range tests {
+		data := decodeData(t, `{"name": "Acme", "address": {"city": "Berlin"}, "empty": null}`)
+		val, ok := takeValue(data, tt.path)
+		if val != tt.val || ok != tt.ok {
+			t.Errorf("takeValue(%s) = %v, %v; want %v, %v", tt.path, val, ok, tt.val, tt.ok)
+		}
+		if got := encode(t, data); got != tt.rest {
+			t.Errorf("takeValue(%s) left %s, want %s", tt.path, got, tt.rest)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		err  string
+	}{
+		{"name", `{"address":{"city":"Berlin"},"empty":null,"name":"x"}`, ""},
+		{"address.zip", `{"address":{"city":"Berlin","zip":"x"},"empty":null,"name":"Acme"}`, ""},
+		{"contact.phone.mobile", `{"address":{"city":"Berlin"},"contact":{"phone":{"mobile":"x"}},"empty":null,"name":"Acme"}`, ""},
+		{"empty.value", `{"address":{"city":"Berlin"},"empty":{"value":"x"},"name":"Acme"}`, ""},
+		{"name.first", "", "name is not an object"},
+		{"address.city.name", "", "address.city is not an object"},
+	}
+	for _, tt := range tests {
+		data := decodeData(t, `{"name": "Acme", "address": {"city": "Berlin"}, "empty": null}`)
+		err := setValue(data, tt.path, "x")
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("setValue(%s) error = %v, want %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("setValue(%s): %v", tt.path, err)
+		}
+		if got := encode(t, data); got != tt.want {
+			t.Errorf("setValue(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateDataChain(t *testing.T) {
+	// v2 renames zip and defaults country; v3 nests the address and drops
+	// the fax number.
+	v2 := formVersion(t, 2, []models.Field{
+		{Name: "zip_code", Type: "string"},
+		{Name: "country", Type: "string"},
+		{Name: "fax", Type: "string"},
+	},
+		models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		models.FieldMapping{Op: models.MappingDefault, Field: "country", Value: "DE"},
+	)
+	v3 := formVersion(t, 3, []models.Field{
+		{Name: "address", Type: "object", Required: true, Fields: []models.Field{
+			{Name: "zip_code", Type: "string", Required: true},
+			{Name: "country", Type: "string"},
+		}},
+	},
+		models.FieldMapping{Op: models.MappingRename, Field: "zip_code", To: "address.zip_code"},
+		models.FieldMapping{Op: models.MappingRename, Field: "country", To: "address.country"},
+		models.FieldMapping{Op: models.MappingDrop, Field: "fax"},
+	)
+
+	data, changes, err := MigrateData([]*models.FormVersion{v2, v3}, `{"zip": "12345", "fax": "0301234"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"address":{"country":"DE","zip_code":"12345"}}`; data != want {
+		t.Errorf("data = %s, want %s", data, want)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Op+":"+c.Field)
+		if c.Version != 2 && c.Version != 3 {
+			t.Errorf("change %+v has version %d", c, c.Version)
+		}
+	}
+	want := "rename:zip,default:country,rename:zip_code,rename:country,drop:fax"
+	if strings.Join(got, ",") != want {
+		t.Errorf("changes = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestMigrateDataFailures(t *testing.T) {
+	target := formVersion(t, 2, []models.Field{
+		{Name: "zip_code", Type: "string", Required: true},
+		{Name: "country", Type: "string", Required: true},
+	},
+		models.FieldMapping{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+	)
+	tests := []struct {
+		name string
+		data string
+		code string // code of the first reported error
+	}{
+		{"invalid after migrating", `{"zip": "12345"}`, CodeRequired},
+		{"rename onto an existing value", `{"zip": "12345", "zip_code": "54321", "country": "DE"}`, CodeMigration},
+		{"not an object", `[1]`, CodeInvalidJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := MigrateData([]*models.FormVersion{target}, tt.data)
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("error = %v, want a validation error", err)
+			}
+			// The caller keeps the draft as it was when nothing is returned.
+			if data != "" {
+				t.Errorf("data = %s, want none", data)
+			}
+			if invalid.Errors[0].Code != tt.code {
+				t.Errorf("errors = %+v, want code %s", invalid.Errors, tt.code)
+			}
+		})
+	}
+}
+
+func TestLintRenameOntoSetPath(t *testing.T) {
+	schema := []models.Field{{Name: "zip_code", Type: "string"}, {Name: "code", Type: "string"}}
+	tests := []struct {
+		name     string
+		mappings []models.FieldMapping
+		problem  bool
+	}{
+		{"rename onto a free path", []models.FieldMapping{
+			{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		}, false},
+		{"rename onto a defaulted path", []models.FieldMapping{
+			{Op: models.MappingDefault, Field: "zip_code", Value: "00000"},
+			{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		}, true},
+		{"two renames onto one path", []models.FieldMapping{
+			{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+			{Op: models.MappingRename, Field: "postcode", To: "zip_code"},
+		}, true},
+		{"rename onto a path moved away", []models.FieldMapping{
+			{Op: models.MappingDefault, Field: "zip_code", Value: "00000"},
+			{Op: models.MappingRename, Field: "zip_code", To: "code"},
+			{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		}, false},
+		{"rename onto a dropped path", []models.FieldMapping{
+			{Op: models.MappingTransform, Field: "zip_code", Expr: `"x"`},
+			{Op: models.MappingDrop, Field: "zip_code"},
+			{Op: models.MappingRename, Field: "zip", To: "zip_code"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			for _, p := range LintSchema(schema, nil, "", tt.mappings) {
+				if p.Code == "invalid_mapping" && strings.Contains(p.Message, "already sets") {
+					found = true
+				}
+			}
+			if found != tt.problem {
+				t.Errorf("rename conflict reported = %v, want %v", found, tt.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+// ruleTimeout bounds the time spent on all rules of one submission.
+const ruleTimeout = 100 * time.Millisecond
+
+// evalRules reports every rule the data breaks. A rule that cannot be
+// evaluated, for example because a value has the wrong type or time ran out,
+// counts as broken unless field errors already explain the problem.
+func evalRules(rules []models.Rule, data map[string]interface{}, errs *fieldErrors) {
+	evalRulesUntil(rules, data, time.Now().Add(ruleTimeout), errs)
+}
+
+func evalRulesUntil(rules []models.Rule, data map[string]interface{}, deadline time.Time, errs *fieldErrors) {
+	fieldErrorsFound := len(*errs) > 0
+	for _, r := range rules {
+		expr, err := compileExpr(r.Expr)
+		ok := false
+		if err == nil {
+			ok, err = expr.evalBool(data, deadline)
+		}
+		if err != nil && fieldErrorsFound {
+			continue
+		}
+		if ok {
+			continue
+		}
+		params := map[string]interface{}{"rule": r.Name}
+		if err != nil {
+			params["error"] = err.Error()
+		}
+		errs.add(r.Field, CodeRule, params, "%s", r.Message)
+	}
+}
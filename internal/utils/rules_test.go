@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"rcs-onboarding/internal/models"
+)
+
+func TestEvalRules(t *testing.T) {
+	positive := models.Rule{Name: "positive", Expr: "amount == null || amount > 0", Message: "amount must be positive", Field: "amount"}
+	typed := models.Rule{Name: "typed", Expr: "amount > 0", Message: "amount must be positive", Field: "amount"}
+	notBool := models.Rule{Name: "not_bool", Expr: "amount", Message: "broken rule", Field: "amount"}
+
+	tests := []struct {
+		name        string
+		rules       []models.Rule
+		data        string
+		fieldErrors int
+		deadline    time.Duration
+		want        []string // rule names reported
+		wantError   string   // substring of the "error" param of the first report
+	}{
+		{name: "rule holds", rules: []models.Rule{positive}, data: `{"amount": 5}`},
+		{name: "rule broken", rules: []models.Rule{positive}, data: `{"amount": -5}`, want: []string{"positive"}},
+		{name: "missing field guarded", rules: []models.Rule{positive}, data: `{}`},
+		{name: "every broken rule is reported", rules: []models.Rule{positive, typed}, data: `{"amount": -1}`, want: []string{"positive", "typed"}},
+		{name: "evaluation error counts as broken", rules: []models.Rule{typed}, data: `{"amount": "x"}`, want: []string{"typed"}, wantError: "cannot apply >"},
+		{name: "evaluation error hidden by field errors", rules: []models.Rule{typed}, data: `{"amount": "x"}`, fieldErrors: 1},
+		{name: "broken rule still reported with field errors", rules: []models.Rule{positive}, data: `{"amount": -1}`, fieldErrors: 1, want: []string{"positive"}},
+		{name: "non-boolean result counts as broken", rules: []models.Rule{notBool}, data: `{"amount": 1}`, want: []string{"not_bool"}, wantError: "must be true or false"},
+		{name: "invalid expression counts as broken", rules: []models.Rule{{Name: "bad", Expr: "amount >", Message: "bad"}}, data: `{}`, want: []string{"bad"}},
+		{name: "rules past the deadline count as broken", rules: []models.Rule{{Name: "slow", Expr: strings.Repeat("1 + ", 99) + "1 > 0", Message: "slow"}},
+			data: `{}`, deadline: -ruleTimeout, want: []string{"slow"}, wantError: errExprTimeout.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(fieldErrors, tt.fieldErrors)
+			deadline := tt.deadline
+			if deadline == 0 {
+				deadline = ruleTimeout
+			}
+			evalRulesUntil(tt.rules, decodeData(t, tt.data), time.Now().Add(deadline), &errs)
+
+			var got []string
+			for _, e := range errs[tt.fieldErrors:] {
+				if e.Code != CodeRule {
+					t.Fatalf("unexpected error %+v", e)
+				}
+				got = append(got, e.Params["rule"].(string))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("broken rules = %v, want %v", got, tt.want)
+			}
+			if tt.wantError != "" {
+				msg, _ := errs[tt.fieldErrors].Params["error"].(string)
+				if !strings.Contains(msg, tt.wantError) {
+					t.Errorf("error param = %q, want one containing %q", msg, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func TestZipCodeRule(t *testing.T) {
+	tests := []struct {
+		data   string
+		broken bool
+	}{
+		{`{"address_zip_code": "12345"}`, false},
+		{`{"address_zip_code": "0"}`, false},
+		{`{}`, false},
+		{`{"address_zip_code": null}`, false},
+		{`{"address_zip_code": "12a45"}`, true},
+		{`{"address_zip_code": "123 45"}`, true},
+		{`{"address_zip_code": ""}`, true},
+		{`{"address_zip_code": 12345}`, true}, // must be sent as a string
+	}
+	for _, tt := range tests {
+		var errs fieldErrors
+		evalRulesUntil([]models.Rule{zipCodeRule}, decodeData(t, tt.data), time.Now().Add(ruleTimeout), &errs)
+		if broken := len(errs) > 0; broken != tt.broken {
+			t.Errorf("%s: broken = %v, want %v (%v)", tt.data, broken, tt.broken, errs)
+		}
+		if len(errs) > 0 && errs[0].Path != "address_zip_code" {
+			t.Errorf("%s: reported on %q", tt.data, errs[0].Path)
+		}
+	}
+}
+
+func TestWithSeededRules(t *testing.T) {
+	schema := func(fields ...models.Field) string {
+		b, _ := json.Marshal(fields)
+		return string(b)
+	}
+	tests := []struct {
+		name      string
+		version   models.FormVersion
+		wantRules []string
+		wantSID   string // Generate of the sid field; "-" when there is none
+	}{
+		{
+			name:      "zip code field gets the rule",
+			version:   models.FormVersion{Type: models.Qualification, Schema: schema(models.Field{Name: "address_zip_code", Type: "string"})},
+			wantRules: []string{"zip_code_numeric"},
+			wantSID:   "-",
+		},
+		{
+			name:    "no zip code field, no rule",
+			version: models.FormVersion{Type: models.Qualification, Schema: schema(models.Field{Name: "brand_name", Type: "string"})},
+			wantSID: "-",
+		},
+		{
+			name:    "customer order sid becomes generated",
+			version: models.FormVersion{Type: models.CustomerOrder, Schema: schema(models.Field{Name: "sid", Type: "string"})},
+			wantSID: "sid",
+		},
+		{
+			name:    "customer order without sid gets one",
+			version: models.FormVersion{Type: models.CustomerOrder, Schema: schema(models.Field{Name: "color", Type: "string"})},
+			wantSID: "sid",
+		},
+		{
+			name:    "other forms keep their sid",
+			version: models.FormVersion{Type: models.Qualification, Schema: schema(models.Field{Name: "sid", Type: "string"})},
+			wantSID: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaJSON, rulesJSON, err := withSeededRules(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated := models.FormVersion{Type: tt.version.Type, Schema: schemaJSON, Rules: rulesJSON}
+			rules, err := updated.DecodeRules()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, r := range rules {
+				names = append(names, r.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("rules = %v, want %v", names, tt.wantRules)
+			}
+			fields, err := updated.Fields()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sid := "-"
+			for _, f := range fields {
+				if f.Name == "sid" {
+					sid = f.Generate
+				}
+			}
+			if sid != tt.wantSID {
+				t.Errorf("sid generate = %q, want %q", sid, tt.wantSID)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"rcs-onboarding/internal/models"
+)
+
+// Kinds of change in a SchemaDiff.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// AttributeChange is one attribute of a field that differs between versions.
+type AttributeChange struct {
+	Attribute string      `json:"attribute"`
+	From      interface{} `json:"from"`
+	To        interface{} `json:"to"`
+	Breaking  bool        `json:"breaking"`
+}
+
+// FieldChange describes a field added, removed or modified between versions.
+// Breaking means data accepted by the old version, such as an existing
+// draft, may be rejected or lose values under the new one.
+type FieldChange struct {
+	Path       string            `json:"path"`
+	Change     string            `json:"change"`
+	Breaking   bool              `json:"breaking"`
+	Reason     string            `json:"reason,omitempty"`
+	Attributes []AttributeChange `json:"attributes,omitempty"`
+}
+
+// RuleChange describes a business rule added, removed or modified.
+type RuleChange struct {
+	Name       string            `json:"name"`
+	Change     string            `json:"change"`
+	Breaking   bool              `json:"breaking"`
+	Attributes []AttributeChange `json:"attributes,omitempty"`
+}
+
+// SchemaDiff lists what changed from one version of a form to another.
+// Breaking is set when any change is.
+type SchemaDiff struct {
+	From          int              `json:"from"`
+	To            int              `json:"to"`
+	Breaking      bool             `json:"breaking"`
+	Fields        []FieldChange    `json:"fields"`
+	Rules         []RuleChange     `json:"rules"`
+	UnknownFields *AttributeChange `json:"unknown_fields,omitempty"`
+}
+
+// DiffVersions compares two form versions field by field, recursing into
+// objects and array items.
+func DiffVersions(from, to *models.FormVersion) (*SchemaDiff, error) {
+	fromFields, err := from.Fields()
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := to.Fields()
+	if err != nil {
+		return nil, err
+	}
+	fromRules, err := from.DecodeRules()
+	if err != nil {
+		return nil, err
+	}
+	toRules, err := to.DecodeRules()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &SchemaDiff{From: from.Version, To: to.Version, Fields: []FieldChange{}, Rules: []RuleChange{}}
+	d.fields(fromFields, toFields, "", policyOf(to))
+	d.rules(fromRules, toRules)
+
+	if policyOf(from) != policyOf(to) {
+		// Keys the old version kept become errors under reject.
+		d.UnknownFields = &AttributeChange{
+			Attribute: "unknown_fields",
+			From:      policyOf(from),
+			To:        policyOf(to),
+			Breaking:  policyOf(to) == models.UnknownFieldsReject,
+		}
+	}
+
+	for _, c := range d.Fields {
+		d.Breaking = d.Breaking || c.Breaking
+	}
+	for _, c := range d.Rules {
+		d.Breaking = d.Breaking || c.Breaking
+	}
+	if d.UnknownFields != nil {
+		d.Breaking = d.Breaking || d.UnknownFields.Breaking
+	}
+	return d, nil
+}
+
+func policyOf(v *models.FormVersion) string {
+	if v.UnknownFields == "" {
+		return models.UnknownFieldsKeep
+	}
+	return v.UnknownFields
+}
+
+func (d *SchemaDiff) fields(from, to []models.Field, prefix string, policy string) {
+	old := make(map[string]models.Field, len(from))
+	for _, f := range from {
+		old[f.Name] = f
+	}
+	seen := map[string]bool{}
+
+	for _, f := range to {
+		path := joinPath(prefix, f.Name)
+		seen[f.Name] = true
+		prev, ok := old[f.Name]
+		if !ok {
+			change := FieldChange{Path: path, Change: ChangeAdded}
+			switch {
+			case f.Required && f.Generate == "":
+				change.Breaking = true
+				change.Reason = "new required field"
+			case f.RequiredIf != nil:
+				change.Breaking = true
+				change.Reason = "new conditionally required field"
+			}
+			d.Fields = append(d.Fields, change)
+			continue
+		}
+		d.field(prev, f, path, policy)
+	}
+
+	for _, f := range from {
+		if seen[f.Name] {
+			continue
+		}
+		change := FieldChange{Path: joinPath(prefix, f.Name), Change: ChangeRemoved}
+		switch policy {
+		case models.UnknownFieldsReject:
+			change.Breaking = true
+			change.Reason = "existing values are rejected as unknown fields"
+		case models.UnknownFieldsStrip:
+			change.Breaking = true
+			change.Reason = "existing values are dropped"
+		}
+		d.Fields = append(d.Fields, change)
+	}
+}
+
+func (d *SchemaDiff) field(from, to models.Field, path string, policy string) {
+	a, b := fieldAttributes(from), fieldAttributes(to)
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	change := FieldChange{Path: path, Change: ChangeModified}
+	for _, k := range names {
+		if reflect.DeepEqual(a[k], b[k]) {
+			continue
+		}
+		breaking := attributeBreaking(k, from, to)
+		change.Attributes = append(change.Attributes, AttributeChange{Attribute: k, From: a[k], To: b[k], Breaking: breaking})
+		change.Breaking = change.Breaking || breaking
+	}
+	if len(change.Attributes) > 0 {
+		d.Fields = append(d.Fields, change)
+	}
+
+	// Nested definitions are compared only when the type stayed the same;
+	// a type change is already reported above.
+	if from.Type != to.Type {
+		return
+	}
+	switch to.Type {
+	case "object":
+		d.fields(from.Fields, to.Fields, path, policy)
+	case "array":
+		if from.Items != nil && to.Items != nil {
+			d.field(*from.Items, *to.Items, path+"[]", policy)
+		}
+	}
+}
+
+// fieldAttributes flattens a field's own attributes, without its name and
+// nested definitions, into their JSON form.
+func fieldAttributes(f models.Field) map[string]interface{} {
+	f.Name, f.Fields, f.Items = "", nil, nil
+	raw, _ := json.Marshal(f)
+	attrs := map[string]interface{}{}
+	json.Unmarshal(raw, &attrs)
+	delete(attrs, "name")
+	return attrs
+}
+
+// attributeBreaking reports whether an attribute that differs between the
+// versions can reject values the old definition accepted.
+func attributeBreaking(attr string, from, to models.Field) bool {
+	switch attr {
+	case "type":
+		return true
+	case "required":
+		return to.Required && !from.Required
+	case "max":
+		return to.Max > 0 && (from.Max == 0 || to.Max < from.Max)
+	case "min":
+		return to.Min > from.Min
+	case "options":
+		for _, o := range from.Options {
+			if !contains(to.Options, o) {
+				return true
+			}
+		}
+		return false
+	case "min_date":
+		return to.MinDate != "" && (from.MinDate == "" || dateBefore(from.MinDate, to.MinDate))
+	case "max_date":
+		return to.MaxDate != "" && (from.MaxDate == "" || dateBefore(to.MaxDate, from.MaxDate))
+	case "precision":
+		return to.Precision > 0 && (from.Precision == 0 || to.Precision < from.Precision)
+	case "pattern":
+		return to.Pattern != ""
+	case "format":
+		return to.Format != ""
+	case "required_if", "forbidden_if", "visible_if":
+		// A new or changed condition can require, forbid or hide values;
+		// dropping one only relaxes validation.
+		return conditionOf(attr, to) != nil
+	}
+	return false
+}
+
+// dateBefore compares two date bounds; unparseable bounds count as a
+// tightening.
+func dateBefore(a, b string) bool {
+	ta, errA := parseDate(a, true)
+	tb, errB := parseDate(b, true)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return ta.Before(tb)
+}
+
+func conditionOf(attr string, f models.Field) *models.Condition {
+	switch attr {
+	case "required_if":
+		return f.RequiredIf
+	case "forbidden_if":
+		return f.ForbiddenIf
+	}
+	return f.VisibleIf
+}
+
+func (d *SchemaDiff) rules(from, to []models.Rule) {
+	old := make(map[string]models.Rule, len(from))
+	for _, r := range from {
+		old[r.Name] = r
+	}
+	seen := map[string]bool{}
+	for _, r := range to {
+		seen[r.Name] = true
+		prev, ok := old[r.Name]
+		if !ok {
+			d.Rules = append(d.Rules, RuleChange{Name: r.Name, Change: ChangeAdded, Breaking: true})
+			continue
+		}
+		change := RuleChange{Name: r.Name, Change: ChangeModified}
+		for _, attr := range []struct {
+			name     string
+			from, to string
+		}{{"expr", prev.Expr, r.Expr}, {"message", prev.Message, r.Message}, {"field", prev.Field, r.Field}} {
+			if attr.from == attr.to {
+				continue
+			}
+			breaking := attr.name == "expr"
+			change.Attributes = append(change.Attributes, AttributeChange{Attribute: attr.name, From: attr.from, To: attr.to, Breaking: breaking})
+			change.Breaking = change.Breaking || breaking
+		}
+		if len(change.Attributes) > 0 {
+			d.Rules = append(d.Rules, change)
+		}
+	}
+	for _, r := range from {
+		if !seen[r.Name] {
+			d.Rules = append(d.Rules, RuleChange{Name: r.Name, Change: ChangeRemoved})
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"rcs-onboarding/internal/models"
+)
+
+// Schema problem severities. Errors block publishing; warnings point at
+// attributes that have no effect.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// SchemaProblem describes one mistake in a form definition. Path locates it:
+// contacts[].email for a field inside array items, rules[0] for a rule.
+type SchemaProblem struct {
+	Path     string `json:"path"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// SchemaError carries the errors that keep a form definition from being
+// published.
+type SchemaError struct {
+	Problems []SchemaProblem
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type schemaLinter struct {
+	problems []SchemaProblem
+}
+
+func (l *schemaLinter) errorf(path string, code string, format string, args ...interface{}) {
+	l.problems = append(l.problems, SchemaProblem{Path: path, Code: code, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *schemaLinter) warnf(path string, code string, format string, args ...interface{}) {
+	l.problems = append(l.problems, SchemaProblem{Path: path, Code: code, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// LintSchema reports every problem in a form definition, errors and warnings
+// alike, so an admin can fix them in one pass.
+func LintSchema(schema []models.Field, rules []models.Rule, unknownFields string, mappings []models.FieldMapping) []SchemaProblem {
+	l := &schemaLinter{}
+	if len(schema) == 0 {
+		l.errorf("", "empty_schema", "schema needs at least one field")
+	}
+	l.fields(schema, "")
+
+	switch unknownFields {
+	case "", models.UnknownFieldsKeep, models.UnknownFieldsStrip, models.UnknownFieldsReject:
+	default:
+		l.errorf("unknown_fields", "invalid_policy", "unknown_fields must be keep, strip or reject")
+	}
+
+	seen := map[string]bool{}
+	for i, r := range rules {
+		path := fmt.Sprintf("rules[%d]", i)
+		if strings.TrimSpace(r.Name) == "" {
+			l.errorf(path, "missing_name", "%s needs a name", path)
+		} else if seen[r.Name] {
+			l.errorf(path, "duplicate_rule", "%s: rule name %s is used more than once", path, r.Name)
+		}
+		seen[r.Name] = true
+		if strings.TrimSpace(r.Message) == "" {
+			l.errorf(path, "missing_message", "%s needs a message", path)
+		}
+		if expr, err := compileExpr(r.Expr); err != nil {
+			l.errorf(path, "invalid_expression", "%s: %v", path, err)
+		} else {
+			for _, ref := range expr.fields {
+				if !schemaHasPath(schema, ref) {
+					l.errorf(path, "unknown_field", "%s reads unknown field %s", path, ref)
+				}
+			}
+		}
+		if r.Field != "" && !schemaHasPath(schema, r.Field) {
+			l.errorf(path, "unknown_field", "%s reports on unknown field %s", path, r.Field)
+		}
+	}
+	l.mappings(schema, mappings)
+	return l.problems
+}
+
+// CheckSchema lints a form definition and returns its errors as a
+// *SchemaError, or nil when it can be published.
+func CheckSchema(schema []models.Field, rules []models.Rule, unknownFields string, mappings []models.FieldMapping) error {
+	var errs []SchemaProblem
+	for _, p := range LintSchema(schema, rules, unknownFields, mappings) {
+		if p.Severity == SeverityError {
+			errs = append(errs, p)
+		}
+	}
+	if len(errs) > 0 {
+		return &SchemaError{Problems: errs}
+	}
+	return nil
+}
+
+// fields lints the fields of one object; prefix is the object's path.
+func (l *schemaLinter) fields(fields []models.Field, prefix string) {
+	seen := map[string]bool{}
+	for _, f := range fields {
+		path := joinPath(prefix, f.Name)
+		if f.Name != "" && seen[f.Name] {
+			l.errorf(path, "duplicate_field", "%s is defined more than once", path)
+		}
+		seen[f.Name] = true
+		l.field(f, path)
+
+		for _, c := range []struct {
+			kind string
+			cond *models.Condition
+		}{{"required_if", f.RequiredIf}, {"visible_if", f.VisibleIf}, {"forbidden_if", f.ForbiddenIf}} {
+			l.condition(path, f.Name, c.kind, c.cond, fields)
+		}
+	}
+}
+
+func (l *schemaLinter) field(f models.Field, path string) {
+	if strings.TrimSpace(f.Name) == "" {
+		l.errorf(path, "missing_name", "every field needs a name")
+	} else if strings.ContainsAny(f.Name, ".[]") {
+		l.errorf(path, "invalid_name", "%s: field names cannot contain . [ or ]", path)
+	}
+
+	text := false
+	switch f.Type {
+	case "string", "url", "email", "phone", "color", "language", "country":
+		text = true
+	case "int", "boolean":
+	case "lookup", "multi_lookup":
+		text = f.Type == "lookup"
+		l.options(f, path)
+	case "date", "datetime":
+		text = true
+		l.dateBounds(f, path)
+	case "decimal":
+		text = true
+		if f.Precision < 0 {
+			l.errorf(path, "invalid_precision", "%s: precision must not be negative", path)
+		}
+	case "object":
+		if len(f.Fields) == 0 {
+			l.errorf(path, "missing_fields", "%s: type object needs fields", path)
+		}
+		l.fields(f.Fields, path)
+	case "array":
+		if f.Items == nil {
+			l.errorf(path, "missing_items", "%s: type array needs items", path)
+			break
+		}
+		item := *f.Items
+		itemPath := path + "[]"
+		if item.RequiredIf != nil || item.VisibleIf != nil || item.ForbiddenIf != nil {
+			l.errorf(itemPath, "invalid_condition", "%s: array items cannot have conditions", itemPath)
+		}
+		// The item schema is addressed by index, so its own name is optional.
+		if item.Name == "" {
+			item.Name = "item"
+		}
+		l.field(item, itemPath)
+	case "":
+		l.errorf(path, "missing_type", "%s needs a type", path)
+	default:
+		l.errorf(path, "unknown_type", "%s: unknown type %q", path, f.Type)
+	}
+
+	if f.Min < 0 || f.Max < 0 {
+		l.errorf(path, "negative_limit", "%s: min and max must not be negative", path)
+	}
+	if f.Min > 0 && f.Max > 0 && f.Min > f.Max {
+		l.errorf(path, "min_greater_than_max", "%s: min %d is greater than max %d", path, f.Min, f.Max)
+	}
+
+	if f.Pattern != "" || f.Format != "" {
+		if !text {
+			l.errorf(path, "unsupported_attribute", "%s: pattern and format only apply to text types", path)
+		}
+		if f.Pattern != "" {
+			if _, err := compilePattern(f.Pattern); err != nil {
+				l.errorf(path, "invalid_pattern", "%s: invalid pattern: %v", path, err)
+			}
+		}
+		if f.Format != "" {
+			if _, ok := lookupFormat(f.Format); !ok {
+				l.errorf(path, "unknown_format", "%s: unknown format %q", path, f.Format)
+			}
+		}
+	}
+	if f.Generate != "" {
+		if _, ok := lookupGenerator(f.Generate); !ok {
+			l.errorf(path, "unknown_generator", "%s: unknown generator %q", path, f.Generate)
+		}
+	}
+
+	l.unusedAttributes(f, path)
+}
+
+func (l *schemaLinter) options(f models.Field, path string) {
+	if len(f.Options) == 0 {
+		l.errorf(path, "missing_options", "%s: type %s needs options", path, f.Type)
+		return
+	}
+	// Submitted options match case-insensitively, and so do duplicates.
+	seen := map[string]bool{}
+	for _, o := range f.Options {
+		key := strings.ToLower(strings.TrimSpace(o))
+		if key == "" {
+			l.errorf(path, "empty_option", "%s: options must not be empty", path)
+			continue
+		}
+		if seen[key] {
+			l.errorf(path, "duplicate_option", "%s: option %q is listed more than once", path, o)
+		}
+		seen[key] = true
+	}
+	if f.Type == "multi_lookup" && f.Min > len(f.Options) {
+		l.errorf(path, "unsatisfiable", "%s: min %d is more than the %d options", path, f.Min, len(f.Options))
+	}
+}
+
+func (l *schemaLinter) dateBounds(f models.Field, path string) {
+	min, minErr := parseDate(f.MinDate, true)
+	max, maxErr := parseDate(f.MaxDate, true)
+	if f.MinDate != "" && minErr != nil {
+		l.errorf(path, "invalid_bound", "%s: invalid min_date %q", path, f.MinDate)
+	}
+	if f.MaxDate != "" && maxErr != nil {
+		l.errorf(path, "invalid_bound", "%s: invalid max_date %q", path, f.MaxDate)
+	}
+	if f.MinDate != "" && f.MaxDate != "" && minErr == nil && maxErr == nil && min.After(max) {
+		l.errorf(path, "min_greater_than_max", "%s: min_date is after max_date", path)
+	}
+}
+
+// unusedAttributes warns about attributes the field's type ignores.
+func (l *schemaLinter) unusedAttributes(f models.Field, path string) {
+	unused := func(attr string) {
+		l.warnf(path, "unused_attribute", "%s: %s has no effect on type %s", path, attr, f.Type)
+	}
+	isDate := f.Type == "date" || f.Type == "datetime"
+	if len(f.Options) > 0 && f.Type != "lookup" && f.Type != "multi_lookup" {
+		unused("options")
+	}
+	if (f.MinDate != "" || f.MaxDate != "") && !isDate {
+		unused("min_date/max_date")
+	}
+	if f.Precision != 0 && f.Type != "decimal" {
+		unused("precision")
+	}
+	if len(f.Fields) > 0 && f.Type != "object" {
+		unused("fields")
+	}
+	if f.Items != nil && f.Type != "array" {
+		unused("items")
+	}
+	switch f.Type {
+	case "lookup", "boolean", "phone", "color", "language", "country", "url", "date", "datetime":
+		if f.Min != 0 || f.Max != 0 {
+			unused("min/max")
+		}
+	case "email":
+		if f.Min != 0 {
+			unused("min")
+		}
+	}
+}
+
+// condition lints one condition of field name, whose siblings are fields.
+func (l *schemaLinter) condition(path string, name string, kind string, c *models.Condition, fields []models.Field) {
+	if c == nil {
+		return
+	}
+	ops := 0
+	for _, set := range []bool{c.Equals != nil, c.NotEquals != nil, c.In != nil, c.NotIn != nil, c.Present != nil} {
+		if set {
+			ops++
+		}
+	}
+	if ops != 1 {
+		l.errorf(path, "invalid_condition", "%s: %s needs exactly one of equals, not_equals, in, not_in or present", path, kind)
+	}
+	switch {
+	case c.Field == name:
+		l.errorf(path, "invalid_condition", "%s: %s refers to the field itself", path, kind)
+	case !schemaHasPath(fields, c.Field):
+		l.errorf(path, "unknown_field", "%s: %s refers to unknown field %q", path, kind, c.Field)
+	}
+}
+
+// mappings lints field mappings. They read data shaped like the previous
+// version, so only the paths they write are checked against schema. A
+// rename fails on drafts that already have a value at its target, so one
+// onto a path an earlier mapping sets is rejected.
+func (l *schemaLinter) mappings(schema []models.Field, mappings []models.FieldMapping) {
+	written := map[string]int{} // path -> index of the mapping that set it
+	for i, m := range mappings {
+		path := fmt.Sprintf("mappings[%d]", i)
+		if strings.TrimSpace(m.Field) == "" {
+			l.errorf(path, "invalid_mapping", "%s needs a field", path)
+			continue
+		}
+		target := m.Field
+		switch m.Op {
+		case models.MappingRename:
+			target = m.To
+			if m.To == "" || m.To == m.Field {
+				l.errorf(path, "invalid_mapping", "%s: rename needs a different to", path)
+				continue
+			}
+			if j, ok := written[m.To]; ok {
+				l.errorf(path, "invalid_mapping", "%s: rename onto %s, which mappings[%d] already sets", path, m.To, j)
+			}
+			delete(written, m.Field)
+		case models.MappingDefault:
+			if m.Value == nil {
+				l.errorf(path, "invalid_mapping", "%s: default needs a value", path)
+			}
+		case models.MappingTransform:
+			if _, err := compileExpr(m.Expr); err != nil {
+				l.errorf(path, "invalid_expression", "%s: %v", path, err)
+			}
+		case models.MappingDrop:
+			delete(written, m.Field)
+			continue
+		default:
+			l.errorf(path, "invalid_mapping", "%s: op must be rename, default, drop or transform", path)
+			continue
+		}
+		written[target] = i
+		if !schemaHasPath(schema, target) {
+			l.errorf(path, "unknown_field", "%s writes unknown field %s", path, target)
+		}
+	}
+}
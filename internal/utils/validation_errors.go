@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Machine-readable validation error codes, stable for API clients.
+const (
+	CodeInvalidJSON     = "invalid_json"
+	CodeRequired        = "required"
+	CodeInvalidType     = "invalid_type"
+	CodeUnknownType     = "unknown_type"
+	CodeMinLength       = "min_length"
+	CodeMaxLength       = "max_length"
+	CodeMin             = "min"
+	CodeMax             = "max"
+	CodeMinItems        = "min_items"
+	CodeMaxItems        = "max_items"
+	CodeInvalidURL      = "invalid_url"
+	CodeInvalidEmail    = "invalid_email"
+	CodeInvalidOption   = "invalid_option"
+	CodeDuplicateOption = "duplicate_option"
+	CodeInvalidDate     = "invalid_date"
+	CodeDateTooEarly    = "date_too_early"
+	CodeDateTooLate     = "date_too_late"
+	CodeInvalidDecimal  = "invalid_decimal"
+	CodePrecision       = "precision"
+	CodeInvalidPhone    = "invalid_phone"
+	CodeInvalidColor    = "invalid_color"
+	CodeInvalidLanguage = "invalid_language"
+	CodeInvalidCountry  = "invalid_country"
+	CodePatternMismatch = "pattern_mismatch"
+	CodeInvalidFormat   = "invalid_format"
+	CodeUnknownField    = "unknown_field"
+	CodeForbidden       = "forbidden"
+	CodeRule            = "rule"
+	CodeMigration       = "migration"
+)
+
+// FieldError describes one problem with submitted data.
+type FieldError struct {
+	Path    string                 `json:"path"` // e.g. contacts[0].email; empty for the whole document
+	Code    string                 `json:"code"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Message string                 `json:"message"`
+}
+
+// ValidationError carries every problem found in one validation pass.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type fieldErrors []FieldError
+
+func (e *fieldErrors) add(path string, code string, params map[string]interface{}, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Code: code, Params: params, Message: fmt.Sprintf(format, args...)})
+}
+
+func expect(kind string) map[string]interface{} {
+	return map[string]interface{}{"expected": kind}
+}
+
+func limit(n int) map[string]interface{} {
+	return map[string]interface{}{"limit": n}
+}
@@ -2,120 +2,228 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
+	"math"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"rcs-onboarding/internal/models"
 
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 
-func ValidateData(schemaStr string, dataStr string, formType models.FormType) (string, error) {
-	var schema []models.Field
-	if err := json.Unmarshal([]byte(schemaStr), &schema); err != nil {
+// ValidateData checks submission data against a form version's fields and
+// business rules and returns the data to store, with unknown keys handled per
+// the version's policy and generated values filled in. Problems with the data
+// are reported together as a *ValidationError; other errors mean the schema
+// itself is unusable.
+func ValidateData(form *models.FormVersion, dataStr string) (string, error) {
+	schema, err := form.Fields()
+	if err != nil {
+		return "", err
+	}
+	rules, err := form.DecodeRules()
+	if err != nil {
 		return "", err
 	}
 
+	// Keep numbers as written so decimal precision can be checked.
 	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
-		return "", err
+	dec := json.NewDecoder(strings.NewReader(dataStr))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil || data == nil {
+		return "", &ValidationError{Errors: []FieldError{{Code: CodeInvalidJSON, Message: "data must be a JSON object"}}}
+	}
+
+	var errs fieldErrors
+	validateFields(schema, "", data, form.UnknownFields, &errs)
+	evalRules(rules, data, &errs)
+	if len(errs) > 0 {
+		return "", &ValidationError{Errors: errs}
+	}
+
+	updatedData, _ := json.Marshal(data)
+	return string(updatedData), nil
+}
+
+// validateFields checks an object's values against its field list; prefix is
+// the object's path, empty at the top level. Keys missing from the field list
+// are kept, stripped or rejected according to policy.
+func validateFields(fields []models.Field, prefix string, data map[string]interface{}, policy string, errs *fieldErrors) {
+	// Conditions see the object as submitted, before hidden values are dropped.
+	states := make([]fieldState, len(fields))
+	for i, f := range fields {
+		states[i] = evalFieldState(f, data)
 	}
 
-	for _, f := range schema {
+	known := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		known[f.Name] = true
+		path := joinPath(prefix, f.Name)
 		val, ok := data[f.Name]
-		if !ok && f.Required {
-			return "", fmt.Errorf("%s is required", f.Name)
-		}
-		if !ok {
-			continue
+		switch {
+		case states[i].hidden:
+			delete(data, f.Name)
+		case ok && states[i].forbidden:
+			errs.add(path, CodeForbidden, nil, "%s is not allowed here", path)
+		case (!ok || val == nil) && f.Generate != "":
+			if generate, found := lookupGenerator(f.Generate); found {
+				data[f.Name] = generate()
+			}
+		case !ok && states[i].required:
+			errs.add(path, CodeRequired, nil, "%s is required", path)
+		case ok:
+			validateField(f, path, val, policy, errs)
 		}
+	}
 
-		switch f.Type {
-		case "string":
-			s, ok := val.(string)
-			if !ok {
-				return "", fmt.Errorf("%s must be string", f.Name)
-			}
-			if f.Max > 0 && len(s) > f.Max {
-				return "", fmt.Errorf("%s exceeds max length %d", f.Name, f.Max)
-			}
-			if f.Min > 0 && len(s) < f.Min {
-				return "", fmt.Errorf("%s below min length %d", f.Name, f.Min)
-			}
-		case "int":
-			iStr, ok := val.(string)
-			if !ok {
-				i, ok := val.(float64)
-				if !ok {
-					return "", fmt.Errorf("%s must be integer", f.Name)
-				}
-				iStr = strconv.Itoa(int(i))
-			}
-			i, err := strconv.Atoi(iStr)
-			if err != nil {
-				return "", fmt.Errorf("%s must be integer", f.Name)
-			}
-			if f.Min > 0 && i < f.Min {
-				return "", fmt.Errorf("%s below min %d", f.Name, f.Min)
-			}
-			if f.Max > 0 && i > f.Max {
-				return "", fmt.Errorf("%s exceeds max %d", f.Name, f.Max)
-			}
-		case "url":
-			s, ok := val.(string)
-			if !ok {
-				return "", fmt.Errorf("%s must be string", f.Name)
-			}
-			_, err := url.ParseRequestURI(s)
-			if err != nil {
-				return "", fmt.Errorf("%s invalid URL", f.Name)
-			}
-		case "email":
-			s, ok := val.(string)
-			if !ok {
-				return "", fmt.Errorf("%s must be string", f.Name)
+	switch policy {
+	case models.UnknownFieldsStrip:
+		for key := range data {
+			if !known[key] {
+				delete(data, key)
 			}
-			if !emailRegex.MatchString(s) {
-				return "", fmt.Errorf("%s invalid email", f.Name)
-			}
-			if f.Max > 0 && len(s) > f.Max {
-				return "", fmt.Errorf("%s exceeds max length %d", f.Name, f.Max)
-			}
-		case "lookup":
-			s, ok := val.(string)
-			if !ok {
-				return "", fmt.Errorf("%s must be string", f.Name)
-			}
-			if !contains(f.Options, s) {
-				return "", fmt.Errorf("%s invalid option: %s", f.Name, s)
+		}
+	case models.UnknownFieldsReject:
+		var unknown []string
+		for key := range data {
+			if !known[key] {
+				unknown = append(unknown, key)
 			}
-		default:
-			return "", fmt.Errorf("unknown type %s for %s", f.Type, f.Name)
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			path := joinPath(prefix, key)
+			errs.add(path, CodeUnknownField, nil, "%s is not a field of this form", path)
 		}
 	}
+}
 
-	// Business rule example
-	if zip, ok := data["address_zip_code"]; ok {
-		if s, ok := zip.(string); ok && !strings.Contains(s, "0123456789") {
-			return "", errors.New("address_zip_code must be numeric")
-		}
+func joinPath(prefix string, name string) string {
+	if prefix == "" {
+		return name
 	}
+	return prefix + "." + name
+}
+
+// validateField checks one value; path locates it in the submission, e.g.
+// contacts[0].email, and is used in error messages. Only the first problem
+// with a value is reported.
+func validateField(f models.Field, path string, val interface{}, policy string, errs *fieldErrors) {
+	before := len(*errs)
+	defer func() {
+		if len(*errs) == before {
+			validateText(f, path, val, errs)
+		}
+	}()
 
-	// Auto SID
-	if formType == models.CustomerOrder && data["sid"] == nil {
-		data["sid"] = "HSN-" + strings.ToUpper(uuid.New().String()[:8])
+	switch f.Type {
+	case "string":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("string"), "%s must be string", path)
+		} else if f.Max > 0 && len(s) > f.Max {
+			errs.add(path, CodeMaxLength, limit(f.Max), "%s exceeds max length %d", path, f.Max)
+		} else if f.Min > 0 && len(s) < f.Min {
+			errs.add(path, CodeMinLength, limit(f.Min), "%s below min length %d", path, f.Min)
+		}
+	case "int":
+		i, ok := parseInt(val)
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("integer"), "%s must be integer", path)
+		} else if f.Min > 0 && i < f.Min {
+			errs.add(path, CodeMin, limit(f.Min), "%s below min %d", path, f.Min)
+		} else if f.Max > 0 && i > f.Max {
+			errs.add(path, CodeMax, limit(f.Max), "%s exceeds max %d", path, f.Max)
+		}
+	case "url":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("string"), "%s must be string", path)
+		} else if _, err := url.ParseRequestURI(s); err != nil {
+			errs.add(path, CodeInvalidURL, nil, "%s invalid URL", path)
+		}
+	case "email":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("string"), "%s must be string", path)
+		} else if !emailRegex.MatchString(s) {
+			errs.add(path, CodeInvalidEmail, nil, "%s invalid email", path)
+		} else if f.Max > 0 && len(s) > f.Max {
+			errs.add(path, CodeMaxLength, limit(f.Max), "%s exceeds max length %d", path, f.Max)
+		}
+	case "lookup":
+		s, ok := val.(string)
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("string"), "%s must be string", path)
+		} else if !contains(f.Options, s) {
+			errs.add(path, CodeInvalidOption, map[string]interface{}{"value": s, "options": f.Options}, "%s invalid option: %s", path, s)
+		}
+	case "date", "datetime":
+		validateDate(f, path, val, errs)
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			errs.add(path, CodeInvalidType, expect("boolean"), "%s must be true or false", path)
+		}
+	case "decimal":
+		validateDecimal(f, path, val, errs)
+	case "phone":
+		if s, ok := val.(string); !ok || !phoneRegex.MatchString(s) {
+			errs.add(path, CodeInvalidPhone, nil, "%s must be an E.164 phone number like +14155550123", path)
+		}
+	case "color":
+		if s, ok := val.(string); !ok || !colorRegex.MatchString(s) {
+			errs.add(path, CodeInvalidColor, nil, "%s must be a hex color like #1A2B3C", path)
+		}
+	case "multi_lookup":
+		validateMultiLookup(f, path, val, errs)
+	case "language":
+		if s, ok := val.(string); !ok || !languageCodes[strings.ToLower(s)] {
+			errs.add(path, CodeInvalidLanguage, nil, "%s must be an ISO 639-1 language code", path)
+		}
+	case "country":
+		if s, ok := val.(string); !ok || !countryCodes[strings.ToUpper(s)] {
+			errs.add(path, CodeInvalidCountry, nil, "%s must be an ISO 3166-1 alpha-2 country code", path)
+		}
+	case "object":
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			errs.add(path, CodeInvalidType, expect("object"), "%s must be an object", path)
+			return
+		}
+		validateFields(f.Fields, path, obj, policy, errs)
+	case "array":
+		validateArray(f, path, val, policy, errs)
+	default:
+		errs.add(path, CodeUnknownType, map[string]interface{}{"type": f.Type}, "unknown type %s for %s", f.Type, path)
 	}
+}
 
-	updatedData, _ := json.Marshal(data)
-	return string(updatedData), nil
+// parseInt reads an int field: a numeric string, or a JSON number with no
+// fractional part. Integral decimals such as 12.0 or 1e3 are accepted, as
+// they were when numbers were decoded as float64.
+func parseInt(val interface{}) (int, bool) {
+	switch v := val.(type) {
+	case string:
+		i, err := strconv.Atoi(v)
+		return i, err == nil
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i, true
+		}
+		f, err := v.Float64()
+		if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(f), true
+	}
+	return 0, false
 }
 
 func contains(options []string, val string) bool {
@@ -127,6 +235,11 @@ func contains(options []string, val string) bool {
 	return false
 }
 
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
@@ -164,7 +277,10 @@ func SeedTemplates(db *gorm.DB) {
 		{Name: "documents", Type: "string", Required: false, Max: 500},
 	}
 	qualSchema, _ := json.Marshal(qualFields)
-	db.Create(&models.FormVersion{Type: models.Qualification, Version: 1, Schema: string(qualSchema)})
+	qualRules, _ := json.Marshal([]models.Rule{zipCodeRule})
+	now := time.Now()
+	db.Create(&models.FormVersion{Type: models.Qualification, Version: 1, Schema: string(qualSchema), Rules: string(qualRules),
+		Status: models.FormVersionPublished, EffectiveAt: &now, PublishedAt: &now})
 
 	// Customer Order Schema
 	orderFields := []models.Field{
@@ -180,10 +296,112 @@ func SeedTemplates(db *gorm.DB) {
 		{Name: "color", Type: "string", Required: true, Max: 10},
 		{Name: "languages", Type: "string", Required: true, Max: 100},
 		{Name: "message_webhook_url", Type: "url", Required: true},
-		{Name: "sid", Type: "string", Required: false},
+		{Name: "sid", Type: "string", Required: false, Generate: "sid"},
 	}
 	orderSchema, _ := json.Marshal(orderFields)
-	db.Create(&models.FormVersion{Type: models.CustomerOrder, Version: 1, Schema: string(orderSchema)})
+	db.Create(&models.FormVersion{Type: models.CustomerOrder, Version: 1, Schema: string(orderSchema), Rules: "[]",
+		Status: models.FormVersionPublished, EffectiveAt: &now, PublishedAt: &now})
+}
+
+var zipCodeRule = models.Rule{
+	Name:    "zip_code_numeric",
+	Expr:    `address_zip_code == null || matches(address_zip_code, "^[0-9]+$")`,
+	Message: "address_zip_code must be numeric",
+	Field:   "address_zip_code",
+}
+
+// SeedFormRules runs once, when business rules move into schemas: the zip
+// code check becomes a rule of every stored version with an
+// address_zip_code field, and customer order SIDs become generated. Once any
+// version has rules it never runs again, so versions saved later are left as
+// their authors wrote them.
+func SeedFormRules(db *gorm.DB) {
+	var migrated int64
+	db.Model(&models.FormVersion{}).Where("rules IS NOT NULL AND rules <> ''").Count(&migrated)
+	if migrated > 0 {
+		return
+	}
+
+	db.Transaction(func(tx *gorm.DB) error {
+		var versions []models.FormVersion
+		if err := tx.Find(&versions).Error; err != nil {
+			return err
+		}
+		for _, v := range versions {
+			schema, rules, err := withSeededRules(v)
+			if err != nil {
+				continue
+			}
+			err = tx.Model(&models.FormVersion{}).Where("id = ?", v.ID).
+				Updates(map[string]interface{}{"schema": schema, "rules": rules}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withSeededRules returns the schema and rules SeedFormRules stores for a
+// version saved before business rules existed.
+func withSeededRules(v models.FormVersion) (string, string, error) {
+	fields, err := v.Fields()
+	if err != nil {
+		return "", "", err
+	}
+	rules := []models.Rule{}
+	hasSID := false
+	for i, f := range fields {
+		if f.Name == "address_zip_code" {
+			rules = append(rules, zipCodeRule)
+		}
+		if f.Name == "sid" && v.Type == models.CustomerOrder && f.Generate == "" {
+			fields[i].Generate = "sid"
+		}
+		hasSID = hasSID || f.Name == "sid"
+	}
+	if v.Type == models.CustomerOrder && !hasSID {
+		fields = append(fields, models.Field{Name: "sid", Type: "string", Generate: "sid"})
+	}
+	schema, err := json.Marshal(fields)
+	if err != nil {
+		return "", "", err
+	}
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return "", "", err
+	}
+	return string(schema), string(rulesJSON), nil
+}
+
+// SeedFormLifecycle dates versions stored before the version lifecycle
+// existed. They were in effect from creation, so the newest stays current.
+func SeedFormLifecycle(db *gorm.DB) {
+	db.Model(&models.FormVersion{}).
+		Where("status = ? AND effective_at IS NULL", models.FormVersionPublished).
+		Updates(map[string]interface{}{"effective_at": gorm.Expr("created_at"), "published_at": gorm.Expr("created_at")})
+}
+
+// SeedFormTypes registers the built-in form types, and any type that already
+// has published versions, so existing forms keep accepting submissions. Role
+// lists start empty: the submission permissions alone decide access.
+func SeedFormTypes(db *gorm.DB) {
+	names := map[models.FormType]string{
+		models.CustomerOrder: "Customer Order",
+		models.Qualification: "Qualification",
+	}
+	var published []models.FormType
+	db.Model(&models.FormVersion{}).Distinct().Pluck("type", &published)
+	for _, key := range published {
+		if _, ok := names[key]; !ok {
+			names[key] = string(key)
+		}
+	}
+	for key, name := range names {
+		db.Where(models.FormTypeDefinition{Key: key}).
+			Attrs(models.FormTypeDefinition{DisplayName: name, Enabled: true}).
+			FirstOrCreate(&models.FormTypeDefinition{})
+	}
 }
 
 func SeedUsers(db *gorm.DB) {
@@ -199,3 +417,53 @@ func SeedUsers(db *gorm.DB) {
 	db.Create(&models.User{Username: "tpm", Password: string(hash), Role: models.TPM})
 	db.Create(&models.User{Username: "sales", Password: string(hash), Role: models.Sales})
 }
+
+// SeedOrganizations runs once, when organizations are introduced: every
+// existing customer gets an organization of their own and their submissions
+// move into it, so nobody loses access to their drafts.
+func SeedOrganizations(db *gorm.DB) {
+	var count int64
+	db.Model(&models.Organization{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	var customers []models.User
+	db.Where("role = ? AND organization_id IS NULL", models.Customer).Find(&customers)
+	for _, u := range customers {
+		org := models.Organization{Name: u.Username}
+		if err := db.Create(&org).Error; err != nil {
+			continue
+		}
+		db.Model(&models.User{}).Where("id = ?", u.ID).Update("organization_id", org.ID)
+		db.Model(&models.Submission{}).Where("user_id = ? AND organization_id = 0", u.ID).Update("organization_id", org.ID)
+	}
+}
+
+// SeedRoles creates the built-in roles and applies the default grants of any
+// permission the database has not seen before. Grants an admin has since
+// edited are left alone.
+func SeedRoles(db *gorm.DB) {
+	for _, role := range []models.Role{models.Customer, models.TPM, models.Sales, models.Admin} {
+		db.Where(models.RoleDefinition{Name: role}).
+			Attrs(models.RoleDefinition{Builtin: true}).
+			FirstOrCreate(&models.RoleDefinition{})
+	}
+
+	for _, perm := range models.Permissions {
+		var count int64
+		db.Model(&models.KnownPermission{}).Where("name = ?", perm.Name).Count(&count)
+		if count > 0 {
+			continue
+		}
+		db.Transaction(func(tx *gorm.DB) error {
+			for _, role := range perm.DefaultRoles {
+				grant := models.RolePermission{Role: role, Permission: perm.Name}
+				if err := tx.Where(grant).FirstOrCreate(&grant).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&models.KnownPermission{Name: perm.Name}).Error
+		})
+	}
+}
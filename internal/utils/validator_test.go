@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want int
+		ok   bool
+	}{
+		{json.Number("12"), 12, true},
+		{json.Number("-3"), -3, true},
+		{json.Number("12.0"), 12, true},
+		{json.Number("1e3"), 1000, true},
+		{json.Number("12.5"), 0, false},
+		{json.Number("1e300"), 0, false},
+		{"42", 42, true},
+		{"12.0", 0, false},
+		{"abc", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseInt(tt.val)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseInt(%#v) = %d, %v; want %d, %v", tt.val, got, ok, tt.want, tt.ok)
+		}
+	}
+}